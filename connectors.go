@@ -0,0 +1,10 @@
+package main
+
+// Every connector registers itself in its init function. Additional connectors only need to be imported here.
+import (
+	_ "Logseq_connector/controller/calendar"
+	_ "Logseq_connector/controller/gitlab"
+	_ "Logseq_connector/controller/jira"
+	_ "Logseq_connector/controller/paperless"
+	_ "Logseq_connector/controller/sapcloudalm"
+)
@@ -1,7 +1,10 @@
 package calendar
 
 import (
-	"Logseq_connector/controller/fileFunctions"
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/logseq"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/apognu/gocal"
 	"golang.org/x/text/language"
@@ -9,7 +12,6 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -22,64 +24,53 @@ type Config struct {
 	Icon  string
 }
 
-var config Config
-
-func GetCalendar(extConf Config, path string) {
-	config = extConf
-
-	icsName := config.Name + ".ics"
-
-	filename := path + "journals/"
+// Connector writes the events of one ICS calendar into the daily journal pages.
+type Connector struct {
+	config Config
+	events []gocal.Event
+}
 
-	err := downloadFile(icsName, config.Ics)
-	if err != nil {
-		panic(err)
-	}
+func init() {
+	connector.Register("calendar", connector.Instances(New))
+}
 
-	f, _ := os.Open(icsName)
-	defer func(f *os.File) {
-		err := f.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(f)
+// New creates a calendar connector for the given instance configuration.
+func New(extConf Config) connector.Connector {
+	return &Connector{config: extConf}
+}
 
-	start, end := time.Now().Add(-(24 * time.Hour)), time.Now().Add(24*time.Hour)
+// Name returns the configured instance name.
+func (c *Connector) Name() string {
+	return c.config.Name
+}
 
-	c := gocal.NewParser(f)
-	c.Start, c.End = &start, &end
+// Graph returns the key of the graph whose journals receive the events.
+func (c *Connector) Graph() string {
+	return c.config.Graph
+}
 
-	if err := c.Parse(); err != nil {
-		log.Println(err.Error())
+// Validate checks that all required settings of the instance are present.
+func (c *Connector) Validate() error {
+	switch {
+	case c.config.Name == "":
+		return errors.New("name is required")
+	case c.config.Ics == "":
+		return errors.New("ics is required")
+	case c.config.Icon == "":
+		return errors.New("icon is required")
 	}
 
-	for _, e := range c.Events {
-		fileHandle, handleErr := fileFunctions.GetFilehandle(filename + e.Start.Format("2006_01_02.md"))
-		if handleErr != nil {
-			log.Println(handleErr)
-		}
-
-		fileContent := fileFunctions.GetFileContent(fileHandle)
-
-		_, found := searchInString(fileContent, e.Summary)
-		if !found {
-			addToFile(fileHandle, "{{i "+config.Icon+"}} *"+e.Start.Format("15:04")+"* [["+config.Name+"]]: [["+e.Summary+"]]", strings.ReplaceAll(trimTeamsHelp(e.Description), "\\n", "\n"))
-		}
+	return nil
+}
 
-		err := fileHandle.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}
-	err = os.Remove(icsName)
+// Fetch downloads the ICS file and parses the events from yesterday until tomorrow.
+func (c *Connector) Fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Ics, nil)
 	if err != nil {
-		log.Println(err)
+		return err
 	}
-}
 
-func downloadFile(filepath string, url string) error {
-	// Get the data
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -90,24 +81,64 @@ func downloadFile(filepath string, url string) error {
 		}
 	}(resp.Body)
 
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download calendar: %s", resp.Status)
 	}
-	defer func(out *os.File) {
-		err := out.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(out)
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+	start, end := time.Now().Add(-(24 * time.Hour)), time.Now().Add(24*time.Hour)
+
+	parser := gocal.NewParser(resp.Body)
+	parser.Start, parser.End = &start, &end
+
+	err = parser.Parse()
+	c.events = parser.Events
+
 	return err
 }
 
-func addToFile(fileHandle *os.File, summary string, description string) {
+// Render returns one journal page per day, to which all events missing on that day are appended.
+func (c *Connector) Render() []connector.Page {
+	var pages []connector.Page
+	days := make(map[string][]gocal.Event)
+
+	for _, e := range c.events {
+		filename := "journals/" + e.Start.Format("2006_01_02.md")
+		if _, ok := days[filename]; !ok {
+			pages = append(pages, connector.Page{
+				File: filename,
+				Update: func(fileContent string) string {
+					page := logseq.ParsePage(fileContent)
+
+					for _, e := range days[filename] {
+						id := "calendar/" + c.config.Name + "/" + e.Uid + "/" + e.Start.Format(time.RFC3339)
+						if logseq.FindById(page, id) != nil {
+							continue
+						}
+
+						_, found := searchInString(page.String(), e.Summary)
+						if !found {
+							blocks := eventBlocks("{{i "+c.config.Icon+"}} *"+e.Start.Format("15:04")+"* [["+c.config.Name+"]]: [["+e.Summary+"]]", strings.ReplaceAll(trimTeamsHelp(e.Description), "\\n", "\n"))
+							logseq.SetIdentity(blocks[0], id)
+							page.Append(blocks...)
+						}
+					}
+
+					return page.String()
+				},
+			})
+		}
+		days[filename] = append(days[filename], e)
+	}
+
+	for i := range pages {
+		pages[i].Items = len(days[pages[i].File])
+	}
+
+	return pages
+}
+
+// eventBlocks renders an event as block, with the description as collapsed child block.
+func eventBlocks(summary string, description string) []*logseq.Block {
 	var desc string
 
 	if len(description) > 0 {
@@ -115,9 +146,7 @@ func addToFile(fileHandle *os.File, summary string, description string) {
 		desc += "\n  - " + description
 	}
 
-	if _, err := fileHandle.WriteString(emptyLine(fileHandle) + summary + desc); err != nil {
-		log.Println(err)
-	}
+	return logseq.ParsePage("- " + summary + desc).Blocks
 }
 
 func searchInString(fileContent string, searchString string) (int, bool) {
@@ -130,59 +159,6 @@ func searchInString(fileContent string, searchString string) (int, bool) {
 	return index, true
 }
 
-func emptyLine(fileHandle *os.File) string {
-	lastLine := getLastLineWithSeek(fileHandle)
-
-	fileInfo, _ := fileHandle.Stat()
-	if fileInfo.Size() == 0 {
-		return "- "
-	}
-
-	if len(lastLine) == 1 {
-		return " "
-	}
-
-	if len(lastLine) > 0 {
-		return "\n- "
-	}
-
-	return "- "
-}
-
-func getLastLineWithSeek(fileHandle *os.File) string {
-	line := ""
-	var cursor int64 = 0
-	stat, _ := fileHandle.Stat()
-
-	if stat.Size() > 0 {
-		for {
-			cursor -= 1
-			_, err := fileHandle.Seek(cursor, io.SeekEnd)
-			if err != nil {
-				log.Println(err)
-			}
-
-			char := make([]byte, 1)
-			_, err = fileHandle.Read(char)
-			if err != nil {
-				log.Println(err)
-			}
-
-			if cursor != -1 && (char[0] == 10 || char[0] == 13) { // stop if we find a line
-				break
-			}
-
-			line = fmt.Sprintf("%s%s", string(char), line) // there is more efficient way
-
-			if cursor == -stat.Size() { // stop if we are at the begining
-				break
-			}
-		}
-	}
-
-	return line
-}
-
 func trimTeamsHelp(input string) string {
 	condRegex := regexp.MustCompile(`(?ms)^[ \t]*_{2,}.*\n[ \t]*Microsoft Teams[\s\S]*?^[ \t]*_{2,}.*\n`)
 	unescaped := strings.ReplaceAll(input, `\n`, "\n")
@@ -0,0 +1,45 @@
+package calendar
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetch(t *testing.T) {
+	start := time.Now().UTC().Format("20060102T150405Z")
+	end := time.Now().Add(time.Hour).UTC().Format("20060102T150405Z")
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"DTSTAMP:" + start,
+		"DTSTART:" + start,
+		"DTEND:" + end,
+		"SUMMARY:Standup",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(ics))
+	}))
+	defer server.Close()
+
+	t.Chdir(t.TempDir())
+	c := &Connector{config: Config{Name: "work", Ics: server.URL}}
+	if err := c.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.events) != 1 || c.events[0].Summary != "Standup" {
+		t.Errorf("events = %v, want the standup", c.events)
+	}
+	if files, _ := os.ReadDir("."); len(files) != 0 {
+		t.Errorf("Fetch() left %d files in the working directory", len(files))
+	}
+}
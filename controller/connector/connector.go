@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Connector is the common lifecycle of every system which is synchronized into a Logseq graph.
+type Connector interface {
+	// Name returns the instance name as configured in config.json.
+	Name() string
+	// Graph returns the key of the graph the instance writes to.
+	Graph() string
+	// Validate checks the instance configuration before anything is fetched.
+	Validate() error
+	// Fetch loads the current data from the source system.
+	Fetch(ctx context.Context) error
+	// Render returns the pages which have to be updated with the fetched data.
+	Render() []Page
+}
+
+// Pusher is implemented by connectors which write changes made in the graph back to the source system.
+type Pusher interface {
+	// Push is called before Fetch with the folder of the graph, so the following Fetch already returns the pushed state.
+	// The returned pages are written right away, e.g. to record what was pushed, also if an error is returned.
+	Push(ctx context.Context, graph fs.FS) ([]Page, error)
+}
+
+// Reader is implemented by connectors which need to know the graph before fetching, e.g. to find the pages they
+// created in earlier runs.
+type Reader interface {
+	// Read is called with the folder of the graph before Push and Fetch, in a dry run as well. It must not change it.
+	Read(graph fs.FS) error
+}
+
+// Page describes the change of a single file inside a graph.
+type Page struct {
+	// File is the path of the file relative to the graph folder, e.g. "pages/jira___work.md".
+	File string
+	// Update receives the current content of the file and returns the new content.
+	Update func(content string) string
+	// Items is the number of entries the connector rendered into the page, as reported in the run summary.
+	Items int
+}
+
+// Instance is a configured connector together with the settings all connectors share.
+type Instance struct {
+	Connector
+	// Interval is the time between two runs in daemon mode. Zero means the global default is used.
+	Interval time.Duration
+}
+
+// settings holds the config.json fields every instance may set, regardless of its connector.
+type settings struct {
+	Interval string
+}
+
+// Factory creates the connector instances of one config.json section.
+type Factory func(raw json.RawMessage) ([]Instance, error)
+
+type registration struct {
+	key     string
+	factory Factory
+}
+
+var registry []registration
+
+// Register makes a connector available under the given config.json key. It is meant to be called from init.
+func Register(key string, factory Factory) {
+	for _, r := range registry {
+		if strings.EqualFold(r.key, key) {
+			panic("connector: Register called twice for " + key)
+		}
+	}
+
+	registry = append(registry, registration{key: key, factory: factory})
+}
+
+// Instances returns a Factory which decodes a list of instance configs and creates one connector per entry.
+func Instances[C any](newConnector func(C) Connector) Factory {
+	return func(raw json.RawMessage) ([]Instance, error) {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, err
+		}
+
+		instances := make([]Instance, 0, len(entries))
+		for _, entry := range entries {
+			var config C
+			if err := json.Unmarshal(entry, &config); err != nil {
+				return nil, err
+			}
+
+			instance, err := newInstance(newConnector(config), entry)
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, instance)
+		}
+
+		return instances, nil
+	}
+}
+
+// newInstance decodes the shared settings of a config entry for the given connector.
+func newInstance(c Connector, entry json.RawMessage) (Instance, error) {
+	var s settings
+	if err := json.Unmarshal(entry, &s); err != nil {
+		return Instance{}, err
+	}
+
+	instance := Instance{Connector: c}
+	if s.Interval != "" {
+		interval, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return Instance{}, fmt.Errorf("%s: invalid interval: %w", c.Name(), err)
+		}
+		instance.Interval = interval
+	}
+
+	return instance, nil
+}
+
+// Load creates the connector instances of all registered connectors from the config.json sections.
+// Section keys are matched case-insensitively, the result is ordered by key and then by position in the section.
+func Load(sections map[string]json.RawMessage) ([]Instance, error) {
+	var connectors []Instance
+
+	sort.Slice(registry, func(i, j int) bool {
+		return registry[i].key < registry[j].key
+	})
+
+	for _, r := range registry {
+		for key, raw := range sections {
+			if !strings.EqualFold(key, r.key) {
+				continue
+			}
+
+			instances, err := r.factory(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", r.key, err)
+			}
+			connectors = append(connectors, instances...)
+		}
+	}
+
+	return connectors, nil
+}
@@ -0,0 +1,158 @@
+package fileFunctions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// manifestName is the file inside a backup folder which lists the saved files.
+const manifestName = "manifest.json"
+
+// BackupEntry describes the state of a single file before it was changed.
+type BackupEntry struct {
+	// File is the absolute path of the changed file, so a rollback works from any working directory.
+	File string `json:"file"`
+	// Backup is the name of the copy of the previous content inside the backup folder. It is empty for created files.
+	Backup string `json:"backup,omitempty"`
+	// Created reports that the file did not exist before the run.
+	Created bool `json:"created,omitempty"`
+}
+
+// Backup records the previous state of every file changed during one run, so the run can be rolled back.
+// Each run gets its own folder below the backup root, which is only created once the first file is saved.
+type Backup struct {
+	dir     string
+	mu      sync.Mutex
+	entries []BackupEntry
+}
+
+// NewBackup creates the backup of a run starting now, stored below root.
+func NewBackup(root string) *Backup {
+	return &Backup{dir: filepath.Join(root, time.Now().Format("20060102T150405.000000000"))}
+}
+
+// Save stores the previous state of filename. Only the first state of a file within a run is kept.
+func (b *Backup) Save(filename string, content string, existed bool) error {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, entry := range b.entries {
+		if entry.File == filename {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return err
+	}
+
+	entry := BackupEntry{File: filename, Created: !existed}
+	if existed {
+		entry.Backup = strconv.Itoa(len(b.entries)+1) + filepath.Ext(filename)
+		if err := WriteFile(filepath.Join(b.dir, entry.Backup), content); err != nil {
+			return err
+		}
+	}
+	b.entries = append(b.entries, entry)
+
+	// the manifest is rewritten after every file, so it is complete even if the run is aborted
+	manifest, err := json.MarshalIndent(b.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return WriteFile(filepath.Join(b.dir, manifestName), string(manifest))
+}
+
+// Rollback restores all files changed by the latest backed up run below root and removes its backup afterwards,
+// so calling it again goes back one more run. It returns the restored files.
+func Rollback(root string) ([]string, error) {
+	runs, err := backupRuns(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, errors.New("no backup found in " + root)
+	}
+	dir := filepath.Join(root, runs[len(runs)-1])
+
+	manifest, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []BackupEntry
+	if err := json.Unmarshal(manifest, &entries); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %w", dir, err)
+	}
+
+	var restored []string
+	for _, entry := range entries {
+		if entry.Created {
+			if err := os.Remove(entry.File); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return restored, err
+			}
+		} else {
+			content, err := os.ReadFile(filepath.Join(dir, entry.Backup))
+			if err != nil {
+				return restored, err
+			}
+			if err := WriteFile(entry.File, string(content)); err != nil {
+				return restored, err
+			}
+		}
+		restored = append(restored, entry.File)
+	}
+
+	return restored, os.RemoveAll(dir)
+}
+
+// PruneBackups removes all but the newest keep backups below root.
+func PruneBackups(root string, keep int) error {
+	runs, err := backupRuns(root)
+	if err != nil {
+		return err
+	}
+
+	for len(runs) > keep {
+		if err := os.RemoveAll(filepath.Join(root, runs[0])); err != nil {
+			return err
+		}
+		runs = runs[1:]
+	}
+
+	return nil
+}
+
+// backupRuns returns the backup folders below root, oldest first.
+func backupRuns(root string) ([]string, error) {
+	dirEntries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []string
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			runs = append(runs, dirEntry.Name())
+		}
+	}
+	sort.Strings(runs)
+
+	return runs, nil
+}
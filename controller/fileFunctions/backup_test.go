@@ -0,0 +1,66 @@
+package fileFunctions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRollback(t *testing.T) {
+	graph := t.TempDir()
+	root := filepath.Join(t.TempDir(), "backups")
+	if err := WriteFile(filepath.Join(graph, "changed.md"), "old\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the run writes relative paths, the rollback is started from another working directory
+	t.Chdir(graph)
+	backup := NewBackup(root)
+	for _, file := range []string{"changed.md", "created.md"} {
+		if err := UpdateFile(file, func(string) string { return "new\n" }, backup); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(t.TempDir())
+
+	restored, err := Rollback(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("restored %q, want both files", restored)
+	}
+
+	if content, err := os.ReadFile(filepath.Join(graph, "changed.md")); err != nil || string(content) != "old\n" {
+		t.Errorf("changed.md = %q, %v, want the old content", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(graph, "created.md")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("created.md was not removed: %v", err)
+	}
+
+	if _, err := Rollback(root); err == nil {
+		t.Error("second Rollback() found a backup, want the first one removed")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	root := t.TempDir()
+	for _, run := range []string{"20240101T000000", "20240102T000000", "20240103T000000"} {
+		if err := os.Mkdir(filepath.Join(root, run), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := PruneBackups(root, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := backupRuns(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0] != "20240102T000000" || runs[1] != "20240103T000000" {
+		t.Errorf("runs after PruneBackups() = %q, want the newest two", runs)
+	}
+}
@@ -0,0 +1,215 @@
+package fileFunctions
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around every change of a unified diff.
+const diffContext = 3
+
+// maxDiffEdits limits the work of the diff algorithm. Files differing in more lines are shown as replaced entirely.
+const maxDiffEdits = 2000
+
+// edit is a single line of an edit script: ' ' keeps, '-' removes and '+' adds the line. The line includes its line
+// break, so a last line without one differs from the same line with one.
+type edit struct {
+	op   byte
+	line string
+}
+
+// UnifiedDiff returns the changes from oldContent to newContent of filename in unified diff format.
+// It returns an empty string if both contents are equal.
+func UnifiedDiff(filename string, oldContent string, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+
+	edits := diffLines(splitLines(oldContent), splitLines(newContent))
+
+	var sb strings.Builder
+	sb.WriteString("--- " + filename + "\n")
+	sb.WriteString("+++ " + filename + "\n")
+
+	// aLine and bLine are the number of lines of the old and new content before edits[i]
+	aLine, bLine := 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].op == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+
+		// a hunk starts diffContext lines before the change and ends when more than
+		// 2*diffContext unchanged lines follow the last change
+		start := max(i-diffContext, 0)
+		for j := i - 1; j >= start; j-- {
+			aLine--
+			bLine--
+		}
+
+		end, unchanged := i, 0
+		for j := i; j < len(edits) && unchanged <= 2*diffContext; j++ {
+			if edits[j].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+				end = j
+			}
+		}
+		end = min(end+diffContext+1, len(edits))
+
+		aCount, bCount := 0, 0
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+
+		sb.WriteString(fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount)))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.op)
+			sb.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		aLine += aCount
+		bLine += bCount
+		i = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the start line and line count of one side of a hunk header.
+func hunkRange(line int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+// splitLines splits content into lines, each with its line break. The last line has none if the content does not end
+// with a line break. An empty content has no lines at all.
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines returns a shortest edit script turning a into b, using the algorithm of Eugene W. Myers.
+func diffLines(a []string, b []string) []edit {
+	var prefix, suffix []edit
+
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]edit{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	return append(append(prefix, myers(a, b)...), suffix...)
+}
+
+// myers computes the edit script of the differing middle part of two files.
+func myers(a []string, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v[-d-1..d+1] before step d, which is all the backtracking needs
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+
+	// too many differences, show the part as replaced entirely
+	edits := make([]edit, 0, n+m)
+	for _, line := range a {
+		edits = append(edits, edit{'-', line})
+	}
+	for _, line := range b {
+		edits = append(edits, edit{'+', line})
+	}
+
+	return edits
+}
+
+// backtrack follows the trace of myers from the end of both files back to the start and returns the edit script.
+func backtrack(a []string, b []string, trace [][]int) []edit {
+	var edits []edit
+	x, y := len(a), len(b)
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		// v returns the furthest x of diagonal k before step d
+		v := func(k int) int {
+			return trace[d][k+d+1]
+		}
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{' ', a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{'+', b[y-1]})
+			} else {
+				edits = append(edits, edit{'-', a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
@@ -0,0 +1,96 @@
+package fileFunctions
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "x\n",
+			want: "@@ -0,0 +1,1 @@\n+x\n",
+		},
+		{
+			name: "deleted content",
+			old:  "x\ny\n",
+			new:  "",
+			want: "@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			name: "changed line",
+			old:  "a\nb\nc\n",
+			new:  "a\nB\nc\n",
+			want: "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "added line at end",
+			old:  "a\n",
+			new:  "a\nb\n",
+			want: "@@ -1,1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			name: "no newline at end",
+			old:  "a\nb",
+			new:  "a\nc",
+			want: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name: "newline added at end",
+			old:  "a",
+			new:  "a\n",
+			want: "@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			want: "@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "near changes in one hunk",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			new:  "one\n2\n3\n4\n5\n6\n7\neight\n",
+			want: "@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = "--- f.md\n+++ f.md\n" + want
+			}
+
+			if got := UnifiedDiff("f.md", tt.old, tt.new); got != want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffTooManyEdits(t *testing.T) {
+	var old, new strings.Builder
+	for i := 0; i < maxDiffEdits; i++ {
+		old.WriteString("a\n")
+		new.WriteString("b\n")
+	}
+
+	got := UnifiedDiff("f.md", old.String(), new.String())
+	if !strings.Contains(got, "@@ -1,2000 +1,2000 @@\n") {
+		t.Errorf("UnifiedDiff() does not replace the file entirely:\n%.200s", got)
+	}
+}
@@ -1,40 +1,79 @@
 package fileFunctions
 
 import (
-	"io"
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 )
 
-func GetFileContent(fileHandle *os.File) string {
-	b, err := io.ReadAll(fileHandle)
+// WriteFile writes content to filename through a temporary file in the same folder, which then replaces filename.
+// Readers like the Logseq file watcher therefore see either the old or the new content, but never a partial one.
+func WriteFile(filename string, content string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
 	if err != nil {
-		log.Println(err)
+		return err
 	}
+	defer func(name string) {
+		// after a successful rename the temporary file does not exist anymore
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Println(err)
+		}
+	}(tmp.Name())
 
-	return string(b)
+	if _, err := tmp.WriteString(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
 }
 
-func GetFilehandle(filename string) (*os.File, error) {
-	fileHandle, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
-	if err != nil {
-		return nil, err
+// UpdateFile passes the current content of filename to update and writes the result back if it has changed.
+// Missing files are created, unless the new content is empty. If backup is not nil, the previous state of the file is saved to it first.
+func UpdateFile(filename string, update func(content string) string, backup *Backup) error {
+	b, err := os.ReadFile(filename)
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
-	return fileHandle, nil
-}
 
-func WriteFile(newContent string, fileHandle *os.File) {
-	oldContent := GetFileContent(fileHandle)
+	oldContent := string(b)
+	newContent := update(oldContent)
+	if newContent == oldContent && (existed || newContent == "") {
+		return nil
+	}
 
-	if newContent != oldContent {
-		if err := fileHandle.Truncate(0); err != nil {
-			log.Println(err.Error())
-		}
-		if _, err := fileHandle.Seek(0, 0); err != nil {
-			log.Println(err.Error())
-		}
-		if _, err := fileHandle.Write([]byte(newContent)); err != nil {
-			log.Println(err.Error())
+	if backup != nil {
+		if err := backup.Save(filename, oldContent, existed); err != nil {
+			return err
 		}
 	}
+
+	return WriteFile(filename, newContent)
+}
+
+// ReadFile returns the content of filename, or an empty string if the file does not exist yet.
+func ReadFile(filename string) (string, error) {
+	b, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	return string(b), err
 }
@@ -1,14 +1,33 @@
 package gitlab
 
 import (
-	"Logseq_connector/controller/fileFunctions"
+	"Logseq_connector/controller/connector"
 	"Logseq_connector/controller/logseq"
+	"context"
+	"errors"
+	"fmt"
 	git "github.com/xanzy/go-gitlab"
+	"io/fs"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// ownedProperties are the properties rendered for an issue. All other properties of an issue entry belong to the user.
+// Both date keywords are owned, so switching Config.DueDate moves the due date.
+var ownedProperties = append([]string{"DEADLINE", "milestone", "assignee", "weight", "time-estimate", "time-spent",
+	"epic", "iteration", "completed", updatedProperty}, logseq.TaskProperties...)
+
+// Due date keywords, see Config.DueDate.
+const (
+	DueDateScheduled = "scheduled"
+	DueDateDeadline  = "deadline"
+)
+
+// updatedProperty holds the time the issue was last updated in GitLab at the last sync, if write-back is enabled.
+const updatedProperty = "logseq-connector-updated"
+
 type Config struct {
 	Name             string
 	Project          string
@@ -20,47 +39,318 @@ type Config struct {
 	Sort             string
 	State            string
 	Scope            string
-	Client           *git.Client
+	Stale            logseq.StaleConfig
+	// WriteBack enables closing and reopening issues whose marker was changed in Logseq.
+	WriteBack bool
+	// MergeRequests enables syncing the open merge requests assigned to the user or awaiting the user's review.
+	MergeRequests bool
+	// MergeRequestStatusMap overrides or extends mergeRequestMarkers, the markers of the merge request states.
+	MergeRequestStatusMap map[string]string
+	// ProjectCacheTTL enables caching the project metadata on disk for the given duration, e.g. "24h".
+	ProjectCacheTTL string
+	// DueDate is the keyword the due date of an issue is rendered with, DueDateScheduled (default) or DueDateDeadline.
+	DueDate string
+	// PagePerProject enables a page per project instead of the tickets page, and an index page linking them.
+	PagePerProject bool
+	// LabelRules map labels to priorities and markers, see LabelRule. The first matching rule wins.
+	LabelRules []LabelRule
+	// Mapping overrides or extends stateMarkers. The priorityMap maps labels to priorities and takes precedence over
+	// the label rules and the built-in priority::1 to priority::4 labels.
+	logseq.Mapping
+	Client *git.Client
 }
 
-var config Config
+// Connector synchronizes the issues of one GitLab instance.
+type Connector struct {
+	config  Config
+	entries []logseq.Entry
+	// issues are the fetched issues, in the order of their entries.
+	issues        []*git.Issue
+	mergeRequests []logseq.Entry
+	// projects are the projects of the fetched issues and merge requests by ID, see loadProjects.
+	projects map[int]project
+	// projectPages are the files of the project pages found by Read by project ID, without extension.
+	projectPages map[int]string
+}
 
-func Process(extConfig Config, path string) {
-	config = extConfig
+func init() {
+	connector.Register("gitlab", connector.Instances(New))
+}
+
+// New creates a GitLab connector for the given instance configuration.
+func New(extConfig Config) connector.Connector {
+	return &Connector{config: extConfig}
+}
 
-	config.Client = getClient()
+// Name returns the configured instance name.
+func (c *Connector) Name() string {
+	return c.config.Name
+}
 
-	filename, fileContent := getGitlabIssues()
-	fileHandle, handleErr := fileFunctions.GetFilehandle(path + filename + "tickets.md")
-	if handleErr != nil {
-		log.Println(handleErr)
+// Graph returns the key of the graph the issues are written to.
+func (c *Connector) Graph() string {
+	return c.config.Graph
+}
+
+// Validate checks that all required settings of the instance are present.
+func (c *Connector) Validate() error {
+	switch {
+	case c.config.Name == "":
+		return errors.New("name is required")
+	case c.config.URL == "":
+		return errors.New("url is required")
+	case c.config.AuthToken == "":
+		return errors.New("authToken is required")
+	case c.dueDate() != DueDateScheduled && c.dueDate() != DueDateDeadline:
+		return errors.New("dueDate must be scheduled or deadline")
+	}
+
+	if err := c.validateLabelRules(); err != nil {
+		return err
 	}
-	fileFunctions.WriteFile(fileContent, fileHandle)
+
+	if c.config.ProjectCacheTTL != "" {
+		if _, err := time.ParseDuration(c.config.ProjectCacheTTL); err != nil {
+			return errors.New("invalid projectCacheTTL: " + err.Error())
+		}
+	}
+
+	if err := c.config.Mapping.Validate(); err != nil {
+		return err
+	}
+	if err := c.validateMergeRequestStatusMap(); err != nil {
+		return err
+	}
+
+	return c.config.Stale.Validate()
 }
 
-func getClient() *git.Client {
-	gitClient, err := git.NewClient(
-		config.AuthToken,
-		git.WithBaseURL(config.URL),
-	)
+// Fetch loads the issues from GitLab and formats them into entries of the tickets page, and the merge requests if
+// enabled. The projects of all of them are loaded once up front.
+func (c *Connector) Fetch(ctx context.Context) error {
+	var err error
+
+	c.config.Client, err = c.getClient()
+	if err != nil {
+		return err
+	}
+
+	issues, err := c.getGitlabIssues()
 	if err != nil {
-		log.Println(err.Error())
+		return err
 	}
 
-	return gitClient
+	var mergeRequests []*git.MergeRequest
+	if c.config.MergeRequests {
+		mergeRequests, err = c.getGitlabMergeRequests(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	var projectIds []int
+	for _, issue := range issues {
+		projectIds = append(projectIds, issue.ProjectID)
+	}
+	for _, mr := range mergeRequests {
+		projectIds = append(projectIds, mr.ProjectID)
+	}
+	c.loadProjects(ctx, projectIds)
+
+	c.issues = issues
+	c.entries = nil
+	for _, issue := range issues {
+		c.entries = append(c.entries, c.createIssueEntry(issue))
+	}
+
+	c.mergeRequests = nil
+	for _, mr := range mergeRequests {
+		c.mergeRequests = append(c.mergeRequests, c.createMergeRequestEntry(ctx, mr))
+	}
+
+	return nil
+}
+
+// Render returns the tickets page of the instance, which is rebuilt from the fetched issues, or the project pages if
+// enabled, and the merge requests page if enabled. Child blocks and properties the user added to an entry are kept.
+// Entries which are no longer returned are handled according to the stale setting of the instance.
+func (c *Connector) Render() []connector.Page {
+	var pages []connector.Page
+	if c.config.PagePerProject {
+		pages = c.projectTaskPages()
+	} else {
+		pages = c.taskPages(c.pageFile(), &logseq.TaskPage{Entries: c.entries, Owned: ownedProperties})
+	}
+
+	if c.config.MergeRequests {
+		pages = append(pages, c.taskPages(c.mergeRequestFile(), &logseq.TaskPage{Entries: c.mergeRequests, Owned: mergeRequestProperties})...)
+	}
+
+	return pages
+}
+
+// taskPages returns the page `file` rebuilt from the entries of the task page, and its archive page if configured.
+func (c *Connector) taskPages(file string, page *logseq.TaskPage) []connector.Page {
+	page.Stale = c.config.Stale
+
+	pages := []connector.Page{{File: file + ".md", Items: len(page.Entries), Update: page.Update}}
+	if c.config.Stale.ArchivePage() {
+		pages = append(pages, connector.Page{File: file + "___archive.md", Update: page.UpdateArchive})
+	}
+
+	return pages
+}
+
+// Push closes or reopens every synced issue whose marker was changed in Logseq since the last sync, if write-back
+// is enabled. The marker is mapped to the issue state with getState. If the state of the issue was changed in GitLab
+// since the last sync as well, the change is reported as a conflict and GitLab wins.
+func (c *Connector) Push(ctx context.Context, graph fs.FS) ([]connector.Page, error) {
+	if !c.config.WriteBack {
+		return nil, nil
+	}
+
+	for _, file := range c.issueFiles() {
+		if err := c.pushPage(ctx, graph, file); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
 }
 
-func getGitlabIssues() (filename string, fileContent string) {
+// pushPage pushes the changed markers of the page `file`, see Push.
+func (c *Connector) pushPage(ctx context.Context, graph fs.FS, file string) error {
+	content, err := fs.ReadFile(graph, file+".md")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	page := logseq.ParsePage(string(content))
+	changes := logseq.Changes(page)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if c.config.Client == nil {
+		c.config.Client, err = c.getClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, change := range changes {
+		state := getState(change.Marker)
+		if state == "" || state == getState(change.Synced) {
+			continue
+		}
+
+		synced, _ := logseq.FindById(page, change.Id).Property(updatedProperty)
+		if err := c.setState(ctx, change.Id, state, getState(change.Synced), synced); err != nil {
+			log.Printf("%s: failed to update %s: %v", c.config.Name, change.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// setState changes the state of the issue with the identity `id` to `state`, unless its state in GitLab differs from
+// `syncedState`, the state at the last sync, and the issue was updated after `synced`, the update time at the last
+// sync. Other updates in GitLab, e.g. new comments or labels, are no conflict.
+func (c *Connector) setState(ctx context.Context, id string, state string, syncedState string, synced string) error {
+	project, iid, ok := c.parseId(id)
+	if !ok {
+		return errors.New("invalid identity")
+	}
+
+	issue, _, err := c.config.Client.Issues.GetIssue(project, iid, git.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if issue.State == state {
+		return nil
+	}
+
+	if issue.State != syncedState && changedSince(issue, synced) {
+		return errors.New("conflict: changed in GitLab and Logseq since the last sync, keeping the GitLab state " + issue.State)
+	}
+
+	event := "close"
+	if state == "opened" {
+		event = "reopen"
+	}
+	_, _, err = c.config.Client.Issues.UpdateIssue(project, iid, &git.UpdateIssueOptions{StateEvent: git.String(event)}, git.WithContext(ctx))
+
+	return err
+}
+
+// changedSince reports whether the issue was updated in GitLab after `synced`, the update time at the last sync. An
+// issue without a valid update time counts as changed.
+func changedSince(issue *git.Issue, synced string) bool {
+	syncedAt, err := time.Parse(time.RFC3339Nano, synced)
+
+	return err != nil || issue.UpdatedAt == nil || issue.UpdatedAt.After(syncedAt)
+}
+
+// parseId splits the identity of an issue into the project ID and the issue IID.
+func (c *Connector) parseId(id string) (project int, iid int, ok bool) {
+	projectStr, iidStr, found := strings.Cut(strings.TrimPrefix(id, c.idPrefix()), "#")
+	if !found {
+		return 0, 0, false
+	}
+
+	project, err := strconv.Atoi(projectStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	iid, err = strconv.Atoi(iidStr)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return project, iid, true
+}
+
+// pageFile returns the path of the tickets page of the instance, without extension.
+func (c *Connector) pageFile() string {
+	return "pages/gitlab___" + getProjectPath(c.config.Project) + "tickets"
+}
+
+// dueDate returns the configured due date keyword, DueDateScheduled if none is set.
+func (c *Connector) dueDate() string {
+	if c.config.DueDate == "" {
+		return DueDateScheduled
+	}
+
+	return strings.ToLower(c.config.DueDate)
+}
+
+// idPrefix returns the prefix of the identity of all issues of the instance.
+func (c *Connector) idPrefix() string {
+	return "gitlab/" + c.config.Name + "/"
+}
+
+func (c *Connector) getClient() (*git.Client, error) {
+	return git.NewClient(
+		c.config.AuthToken,
+		git.WithBaseURL(c.config.URL),
+	)
+}
+
+// getGitlabIssues loads the issues matching the configured filters, page by page.
+func (c *Connector) getGitlabIssues() ([]*git.Issue, error) {
 	var issues []*git.Issue
 	sort := "desc"
 	scope := "all"
 
-	if len(config.Sort) > 0 {
-		sort = config.Sort
+	if len(c.config.Sort) > 0 {
+		sort = c.config.Sort
 	}
 
-	if len(config.Scope) > 0 {
-		scope = config.Scope
+	if len(c.config.Scope) > 0 {
+		scope = c.config.Scope
 	}
 
 	issueOpts := &git.ListIssuesOptions{
@@ -68,18 +358,18 @@ func getGitlabIssues() (filename string, fileContent string) {
 		Scope: git.String(scope),
 	}
 
-	if len(config.AssigneeUsername) > 0 {
-		issueOpts.AssigneeUsername = git.String(config.AssigneeUsername)
+	if len(c.config.AssigneeUsername) > 0 {
+		issueOpts.AssigneeUsername = git.String(c.config.AssigneeUsername)
 	}
 
-	if len(config.State) > 0 {
-		issueOpts.State = git.String(config.State)
+	if len(c.config.State) > 0 {
+		issueOpts.State = git.String(c.config.State)
 	}
 
 	for {
-		tempIssues, resp, err := config.Client.Issues.ListIssues(issueOpts)
+		tempIssues, resp, err := c.config.Client.Issues.ListIssues(issueOpts)
 		if err != nil {
-			log.Println(err.Error())
+			return nil, fmt.Errorf("failed to list issues: %w", err)
 		}
 
 		issues = append(issues, tempIssues...)
@@ -91,47 +381,78 @@ func getGitlabIssues() (filename string, fileContent string) {
 		issueOpts.Page = resp.NextPage
 	}
 
-	if len(issues) > 0 {
-		for _, val := range issues {
-			var project, labels, milestone, assignee, closed string
-			projectName, _ := getGitlabProjectName(val.ProjectID)
-
-			if len(config.Project) > 0 {
-				project = "#" + config.Project + " "
-			}
-
-			if len(val.Labels) > 0 {
-				for _, label := range val.Labels {
-					labels = labels + " [[" + label + "]]"
-				}
-			}
-
-			if val.Milestone != nil && len(val.Milestone.Title) > 0 {
-				milestone = " [[Milestone:: " + val.Milestone.Title + "]]"
-			}
+	return issues, nil
+}
 
-			if val.Assignee != nil && len(val.Assignee.Username) > 0 {
-				assignee = " [[Assignee:: " + val.Assignee.Username + "]]"
-			}
+// createIssueEntry formats an issue as task of the tickets page, with its due date as SCHEDULED or DEADLINE and the
+// planning and time tracking fields as properties.
+func (c *Connector) createIssueEntry(val *git.Issue) logseq.Entry {
+	projectName := c.getGitlabProjectName(val.ProjectID)
 
-			if val.ClosedAt != nil {
-				closed = "\n" + "completed:: " + val.ClosedAt.Format("[[01-02-2006]] *15:04*")
-			}
+	var task logseq.Task
+	task.Id = projectName + "#" + strconv.Itoa(val.IID)
+	if val.References != nil && val.References.Full != "" {
+		task.Id = val.References.Full
+	}
+	task.ConfigName = c.config.Name
+	task.Status = c.issueMarker(val)
+	task.Priority = c.getGitlabPriority(val)
+	task.Project = projectName
+	task.Url = val.WebURL
+	task.Title = val.Title
+	task.Deadline = c.dueDate() == DueDateDeadline
+
+	if len(c.config.Project) > 0 {
+		task.Tags = append(task.Tags, c.config.Project)
+	}
+	tags, scoped := splitLabels(val.Labels)
+	task.Tags = append(task.Tags, tags...)
 
-			fileContent = logseq.AddOrReplaceEntry(projectName+" [#"+strconv.Itoa(val.IID)+"]", "- "+getState(val.State)+" "+getGitlabPriority(val)+project+projectName+" [#"+strconv.Itoa(val.IID)+"]("+val.WebURL+")"+" "+val.Title+labels+milestone+assignee+closed, fileContent)
-		}
+	if val.DueDate != nil {
+		task.DueDate = val.DueDate.String()
 	}
 
-	return getProjectPath(config.Project), fileContent
-}
+	taskLine, _ := logseq.CreateTask(task)
+	block := logseq.ParseBlock(taskLine)
 
-func getGitlabProjectName(projectId int) (string, error) {
-	project, _, err := config.Client.Projects.GetProject(projectId, &git.GetProjectOptions{})
-	if err != nil {
-		return "", err
+	for _, label := range scoped {
+		key, value, _ := scopedLabel(label)
+		logseq.SetRenderedProperty(block, labelProperty(key), value)
+	}
+	if val.Milestone != nil && len(val.Milestone.Title) > 0 {
+		block.SetProperty("milestone", "[["+val.Milestone.Title+"]]")
+	}
+	if val.Assignee != nil && len(val.Assignee.Username) > 0 {
+		block.SetProperty("assignee", "[["+val.Assignee.Username+"]]")
+	}
+	if val.Weight > 0 {
+		block.SetProperty("weight", strconv.Itoa(val.Weight))
+	}
+	if val.TimeStats != nil && val.TimeStats.HumanTimeEstimate != "" {
+		block.SetProperty("time-estimate", val.TimeStats.HumanTimeEstimate)
+	}
+	if val.TimeStats != nil && val.TimeStats.HumanTotalTimeSpent != "" {
+		block.SetProperty("time-spent", val.TimeStats.HumanTotalTimeSpent)
+	}
+	if val.Epic != nil && val.Epic.Title != "" {
+		block.SetProperty("epic", "[["+val.Epic.Title+"]]")
+	}
+	if val.Iteration != nil && val.Iteration.Title != "" {
+		block.SetProperty("iteration", "[["+val.Iteration.Title+"]]")
+	}
+	if val.ClosedAt != nil {
+		block.SetProperty("completed", val.ClosedAt.Format("[[01-02-2006]] *15:04*"))
+	}
+	if c.config.WriteBack && val.UpdatedAt != nil {
+		block.SetProperty(updatedProperty, val.UpdatedAt.Format(time.RFC3339Nano))
 	}
 
-	return project.Name, nil
+	return logseq.Entry{
+		Content: block.String(),
+		Id:      c.idPrefix() + strconv.Itoa(val.ProjectID) + "#" + strconv.Itoa(val.IID),
+		// the first line of issues written before they carried an identity
+		UniqueStr: projectName + " [#" + strconv.Itoa(val.IID) + "]",
+	}
 }
 
 func getProjectPath(project string) string {
@@ -142,22 +463,13 @@ func getProjectPath(project string) string {
 	return ""
 }
 
-func getGitlabPriority(issue *git.Issue) string {
-	for _, label := range issue.Labels {
-		if strings.HasPrefix(label, "priority::1 ") {
-			return "[#A] "
-		} else if strings.HasPrefix(label, "priority::2 ") {
-			return "[#B] "
-		} else if strings.HasPrefix(label, "priority::3 ") {
-			return "[#C] "
-		} else if strings.HasPrefix(label, "priority::4 ") {
-			return "[#D] "
-		}
-	}
-
-	return ""
+// stateMarkers are the built-in markers of the issue states.
+var stateMarkers = map[string]string{
+	"opened": "TODO",
+	"closed": "DONE",
 }
 
+// getState maps an issue state to its built-in marker and a marker to the issue state it is pushed as.
 func getState(state string) string {
 	switch state {
 	case "opened":
@@ -0,0 +1,193 @@
+package gitlab
+
+import (
+	"Logseq_connector/controller/logseq"
+	"errors"
+	git "github.com/xanzy/go-gitlab"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LabelRule maps the issues with a matching label to a Logseq priority and/or marker. A rule matches labels by
+// exactly one of Prefix, Regex and Key.
+type LabelRule struct {
+	// Prefix matches labels starting with it, ignoring case, e.g. "P1".
+	Prefix string
+	// Regex matches labels matching the regular expression, e.g. "^severity::(critical|blocker)$".
+	Regex string
+	// Key matches scoped labels with the key, e.g. "severity" for "severity::critical", ignoring case.
+	Key string
+	// Value restricts a Key rule to the scoped label with the value, e.g. "critical".
+	Value string
+	// Priority is the Logseq priority from "A" to "D" of issues with a matching label.
+	Priority string
+	// Marker is the Logseq marker of open issues with a matching label, e.g. "DOING". Closed issues keep theirs.
+	Marker string
+
+	// regex is the compiled Regex, set by validate.
+	regex *regexp.Regexp
+}
+
+// builtinLabelRules are the rules of the priority::1 to priority::4 labels, applied after the configured ones.
+var builtinLabelRules = []LabelRule{
+	{Priority: "A", regex: regexp.MustCompile(`^priority::1\b`)},
+	{Priority: "B", regex: regexp.MustCompile(`^priority::2\b`)},
+	{Priority: "C", regex: regexp.MustCompile(`^priority::3\b`)},
+	{Priority: "D", regex: regexp.MustCompile(`^priority::4\b`)},
+}
+
+// nonPropertyChars matches the characters of a scoped label key which cannot be used in a property name.
+var nonPropertyChars = regexp.MustCompile(`[^\w-]+`)
+
+// validate checks the rule and compiles its regular expression.
+func (r *LabelRule) validate() error {
+	matchers := 0
+	for _, m := range []string{r.Prefix, r.Regex, r.Key} {
+		if m != "" {
+			matchers++
+		}
+	}
+
+	switch {
+	case matchers != 1:
+		return errors.New("label rule must have exactly one of prefix, regex and key")
+	case r.Value != "" && r.Key == "":
+		return errors.New("label rule with value requires key")
+	case r.Priority == "" && r.Marker == "":
+		return errors.New("label rule must have a priority or a marker")
+	case r.Priority != "" && logseq.PriorityNumber(r.Priority) == 0:
+		return errors.New("label rule: priority " + r.Priority + " must be one of A, B, C, D")
+	case r.Marker != "" && !logseq.IsMarker(r.Marker):
+		return errors.New("label rule: " + r.Marker + " is not a Logseq marker")
+	}
+
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return errors.New("label rule: invalid regex: " + err.Error())
+		}
+		r.regex = regex
+	}
+
+	return nil
+}
+
+// matches reports whether the label matches the rule.
+func (r *LabelRule) matches(label string) bool {
+	switch {
+	case r.regex != nil:
+		return r.regex.MatchString(label)
+	case r.Prefix != "":
+		return len(label) >= len(r.Prefix) && strings.EqualFold(label[:len(r.Prefix)], r.Prefix)
+	case r.Key != "":
+		key, value, ok := scopedLabel(label)
+		return ok && strings.EqualFold(key, r.Key) && (r.Value == "" || strings.EqualFold(value, r.Value))
+	}
+
+	return false
+}
+
+// labelRule returns the first rule with a priority or with a marker, as selected by `use`, matching a label of the
+// issue. Configured rules are applied in order before the built-in ones.
+func (c *Connector) labelRule(issue *git.Issue, use func(r *LabelRule) bool) *LabelRule {
+	for _, rules := range [][]LabelRule{c.config.LabelRules, builtinLabelRules} {
+		for i := range rules {
+			if !use(&rules[i]) {
+				continue
+			}
+			for _, label := range issue.Labels {
+				if rules[i].matches(label) {
+					return &rules[i]
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// getGitlabPriority returns the priority of the issue, from 1 (highest) to 4, or 0 if it has none.
+// Labels configured in the priorityMap win over the label rules.
+func (c *Connector) getGitlabPriority(issue *git.Issue) int {
+	for _, label := range issue.Labels {
+		if prio := c.config.Priority(label, nil); prio > 0 {
+			return prio
+		}
+	}
+
+	if rule := c.labelRule(issue, func(r *LabelRule) bool { return r.Priority != "" }); rule != nil {
+		return logseq.PriorityNumber(rule.Priority)
+	}
+
+	return 0
+}
+
+// issueMarker returns the marker of the issue: the one of the first label rule matching an open issue, otherwise the
+// one of its state.
+func (c *Connector) issueMarker(issue *git.Issue) string {
+	if issue.State == "opened" {
+		if rule := c.labelRule(issue, func(r *LabelRule) bool { return r.Marker != "" }); rule != nil {
+			return strings.ToUpper(rule.Marker)
+		}
+	}
+
+	return c.config.Marker(issue.State, stateMarkers)
+}
+
+// scopedLabel splits a scoped label into key and value at the last "::", as GitLab does for nested scopes.
+func scopedLabel(label string) (key string, value string, ok bool) {
+	i := strings.LastIndex(label, "::")
+	if i <= 0 || i+2 == len(label) {
+		return "", "", false
+	}
+
+	return label[:i], label[i+2:], true
+}
+
+// labelProperty returns the property name of a scoped label key, or an empty string if the name is rendered by the
+// connector itself or has a meaning in Logseq, and the label stays a tag.
+func labelProperty(key string) string {
+	name := strings.Trim(nonPropertyChars.ReplaceAllString(strings.ToLower(key), "-"), "-")
+	switch {
+	case name == "", logseq.IsReservedProperty(name), isOwnedProperty(name):
+		return ""
+	}
+
+	return name
+}
+
+// isOwnedProperty reports whether the property is one of the ownedProperties.
+func isOwnedProperty(name string) bool {
+	for _, o := range ownedProperties {
+		if strings.EqualFold(o, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitLabels splits the labels into the scoped labels rendered as properties and the other labels, rendered as tags.
+func splitLabels(labels []string) (tags []string, scoped []string) {
+	for _, label := range labels {
+		if key, _, ok := scopedLabel(label); ok && labelProperty(key) != "" {
+			scoped = append(scoped, label)
+		} else {
+			tags = append(tags, label)
+		}
+	}
+
+	return tags, scoped
+}
+
+// validateLabelRules checks the configured label rules, see LabelRule.validate.
+func (c *Connector) validateLabelRules() error {
+	for i := range c.config.LabelRules {
+		if err := c.config.LabelRules[i].validate(); err != nil {
+			return errors.New(err.Error() + " (rule " + strconv.Itoa(i+1) + ")")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package gitlab
+
+import (
+	"Logseq_connector/controller/logseq"
+	"context"
+	"errors"
+	"fmt"
+	git "github.com/xanzy/go-gitlab"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// mergeRequestProperties are the properties rendered for a merge request. All other properties belong to the user.
+var mergeRequestProperties = append([]string{"draft", "pipeline", "approvals", "target-branch", "reviewers"}, logseq.TaskProperties...)
+
+// mergeRequestMarkers are the built-in markers of the merge request states, see Config.MergeRequestStatusMap.
+var mergeRequestMarkers = map[string]string{
+	"opened": "TODO",
+	"locked": "WAIT",
+	"merged": "DONE",
+	"closed": "CANCELED",
+}
+
+// getGitlabMergeRequests loads the open merge requests assigned to the user or awaiting the user's review.
+// A merge request in both lists is returned once.
+func (c *Connector) getGitlabMergeRequests(ctx context.Context) ([]*git.MergeRequest, error) {
+	user, _, err := c.config.Client.Users.CurrentUser(git.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	assigned, err := c.listMergeRequests(ctx, &git.ListMergeRequestsOptions{Scope: git.String("assigned_to_me")})
+	if err != nil {
+		return nil, err
+	}
+	reviewing, err := c.listMergeRequests(ctx, &git.ListMergeRequestsOptions{Scope: git.String("all"), ReviewerUsername: git.String(user.Username)})
+	if err != nil {
+		return nil, err
+	}
+
+	var mergeRequests []*git.MergeRequest
+	seen := make(map[int]bool)
+	for _, mr := range append(assigned, reviewing...) {
+		if !seen[mr.ID] {
+			seen[mr.ID] = true
+			mergeRequests = append(mergeRequests, mr)
+		}
+	}
+
+	return mergeRequests, nil
+}
+
+// listMergeRequests returns all open merge requests matching the options, requesting them page by page.
+func (c *Connector) listMergeRequests(ctx context.Context, opts *git.ListMergeRequestsOptions) ([]*git.MergeRequest, error) {
+	opts.State = git.String("opened")
+
+	var mergeRequests []*git.MergeRequest
+	for {
+		page, resp, err := c.config.Client.MergeRequests.ListMergeRequests(opts, git.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge requests: %w", err)
+		}
+		mergeRequests = append(mergeRequests, page...)
+
+		if resp.NextPage == 0 {
+			return mergeRequests, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// createMergeRequestEntry formats a merge request as task of the merge requests page. Pipeline status and approvals
+// are loaded per merge request, as the list does not contain them; if that fails, the property is left out.
+func (c *Connector) createMergeRequestEntry(ctx context.Context, mr *git.MergeRequest) logseq.Entry {
+	projectName := c.getGitlabProjectName(mr.ProjectID)
+
+	var task logseq.Task
+	task.Id = projectName + "!" + strconv.Itoa(mr.IID)
+	if mr.References != nil && mr.References.Full != "" {
+		task.Id = mr.References.Full
+	}
+	task.ConfigName = c.config.Name
+	task.Status = c.mergeRequestMapping().Marker(mr.State, mergeRequestMarkers)
+	task.Project = projectName
+	task.Url = mr.WebURL
+	task.Title = mr.Title
+	if len(c.config.Project) > 0 {
+		task.Tags = append(task.Tags, c.config.Project)
+	}
+
+	taskLine, _ := logseq.CreateTask(task)
+	block := logseq.ParseBlock(taskLine)
+
+	block.SetProperty("draft", strconv.FormatBool(mr.Draft))
+
+	if details, _, err := c.config.Client.MergeRequests.GetMergeRequest(mr.ProjectID, mr.IID, nil, git.WithContext(ctx)); err != nil {
+		log.Printf("%s: failed to get merge request !%d: %v", c.config.Name, mr.IID, err)
+	} else if details.HeadPipeline != nil {
+		block.SetProperty("pipeline", details.HeadPipeline.Status)
+	}
+
+	if approvals, _, err := c.config.Client.MergeRequestApprovals.GetConfiguration(mr.ProjectID, mr.IID, git.WithContext(ctx)); err != nil {
+		log.Printf("%s: failed to get approvals of merge request !%d: %v", c.config.Name, mr.IID, err)
+	} else {
+		value := strconv.Itoa(len(approvals.ApprovedBy))
+		if approvals.ApprovalsRequired > 0 {
+			value += "/" + strconv.Itoa(approvals.ApprovalsRequired)
+		}
+		block.SetProperty("approvals", value)
+	}
+
+	block.SetProperty("target-branch", mr.TargetBranch)
+
+	if len(mr.Reviewers) > 0 {
+		var reviewers []string
+		for _, reviewer := range mr.Reviewers {
+			reviewers = append(reviewers, "[["+reviewer.Username+"]]")
+		}
+		block.SetProperty("reviewers", strings.Join(reviewers, ", "))
+	}
+
+	return logseq.Entry{
+		Content: block.String(),
+		Id:      c.idPrefix() + strconv.Itoa(mr.ProjectID) + "!" + strconv.Itoa(mr.IID),
+	}
+}
+
+// mergeRequestMapping returns the mapping of the merge request states: the MergeRequestStatusMap with the fallback
+// marker of the instance.
+func (c *Connector) mergeRequestMapping() logseq.Mapping {
+	return logseq.Mapping{StatusMap: c.config.MergeRequestStatusMap, FallbackMarker: c.config.FallbackMarker}
+}
+
+// validateMergeRequestStatusMap checks that all markers of the MergeRequestStatusMap are valid in Logseq.
+func (c *Connector) validateMergeRequestStatusMap() error {
+	for state, marker := range c.config.MergeRequestStatusMap {
+		if !logseq.IsMarker(marker) {
+			return errors.New("mergeRequestStatusMap: " + marker + " of " + state + " is not a Logseq marker")
+		}
+	}
+
+	return nil
+}
+
+// mergeRequestFile returns the path of the merge requests page of the instance, without extension.
+func (c *Connector) mergeRequestFile() string {
+	return "pages/gitlab___" + getProjectPath(c.config.Project) + "merge_requests"
+}
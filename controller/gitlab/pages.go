@@ -0,0 +1,155 @@
+package gitlab
+
+import (
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/logseq"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Read finds the project pages of earlier runs by their identity, so they keep their file if the project was renamed
+// and are still updated once the project has no synced issues any more.
+func (c *Connector) Read(graph fs.FS) error {
+	c.projectPages = make(map[int]string)
+	if !c.config.PagePerProject {
+		return nil
+	}
+
+	files, err := fs.Glob(graph, "pages/gitlab___*.md")
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		content, err := fs.ReadFile(graph, file)
+		if err != nil {
+			return err
+		}
+
+		id := logseq.ParsePage(string(content)).Properties()[logseq.IdProperty]
+		projectStr, ok := strings.CutPrefix(id, c.projectIdPrefix())
+		if !ok {
+			continue
+		}
+		if projectId, err := strconv.Atoi(projectStr); err == nil {
+			c.projectPages[projectId] = strings.TrimSuffix(file, ".md")
+		}
+	}
+
+	return nil
+}
+
+// projectTaskPages returns a page per project with its issues and the index page linking them. Projects whose page
+// was found by Read are included without issues, so their stale entries are handled.
+func (c *Connector) projectTaskPages() []connector.Page {
+	entries := make(map[int][]logseq.Entry)
+	open := make(map[int]int)
+	closed := make(map[int]int)
+	for i, issue := range c.issues {
+		entries[issue.ProjectID] = append(entries[issue.ProjectID], c.entries[i])
+		if issue.State == "closed" {
+			closed[issue.ProjectID]++
+		} else {
+			open[issue.ProjectID]++
+		}
+	}
+	for projectId := range c.projectPages {
+		if _, ok := entries[projectId]; !ok {
+			entries[projectId] = nil
+		}
+	}
+
+	var pages []connector.Page
+	var index []logseq.Entry
+	for projectId, projectEntries := range entries {
+		file := c.projectFile(projectId)
+
+		page := &logseq.TaskPage{Entries: projectEntries, Owned: ownedProperties, Properties: c.projectProperties(projectId)}
+		pages = append(pages, c.taskPages(file, page)...)
+
+		index = append(index, logseq.Entry{
+			Content: "- [[" + pageName(file) + "]]\n  open:: " + strconv.Itoa(open[projectId]) + "\n  closed:: " + strconv.Itoa(closed[projectId]),
+			Id:      c.projectId(projectId),
+		})
+	}
+
+	// entries are added to the top of the page, so the last one ends up first
+	sort.Slice(index, func(i, j int) bool {
+		return index[i].Content > index[j].Content
+	})
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].File < pages[j].File
+	})
+
+	page := &logseq.TaskPage{Entries: index, Owned: []string{"open", "closed"}}
+	return append(pages, connector.Page{File: c.projectIndexFile() + ".md", Update: page.Update})
+}
+
+// projectProperties returns the page properties of the page of the project: its identity and, if the project was
+// loaded, its name as alias and its description.
+func (c *Connector) projectProperties(projectId int) map[string]string {
+	properties := map[string]string{logseq.IdProperty: c.projectId(projectId)}
+
+	if p, ok := c.projects[projectId]; ok {
+		if p.Name != "" {
+			properties["alias"] = p.Name
+		}
+		if description := strings.Join(strings.Fields(p.Description), " "); description != "" {
+			properties["description"] = description
+		}
+	}
+
+	return properties
+}
+
+// projectFile returns the path of the page of the project, without extension. A page found by Read keeps its file,
+// new pages are named after the path of the project.
+func (c *Connector) projectFile(projectId int) string {
+	if file, ok := c.projectPages[projectId]; ok {
+		return file
+	}
+
+	name := "project_" + strconv.Itoa(projectId)
+	if p, ok := c.projects[projectId]; ok && p.Path != "" {
+		name = strings.ReplaceAll(p.Path, "/", "___")
+	}
+
+	return "pages/gitlab___" + getProjectPath(c.config.Project) + name
+}
+
+// projectIndexFile returns the path of the page linking the project pages, without extension.
+func (c *Connector) projectIndexFile() string {
+	return "pages/gitlab___" + getProjectPath(c.config.Project) + "projects"
+}
+
+// issueFiles returns the paths of the pages holding the synced issues, without extension.
+func (c *Connector) issueFiles() []string {
+	if !c.config.PagePerProject {
+		return []string{c.pageFile()}
+	}
+
+	var files []string
+	for _, file := range c.projectPages {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// projectIdPrefix returns the prefix of the identity of the project pages of the instance.
+func (c *Connector) projectIdPrefix() string {
+	return c.idPrefix() + "project/"
+}
+
+// projectId returns the identity of the page of the project.
+func (c *Connector) projectId(projectId int) string {
+	return c.projectIdPrefix() + strconv.Itoa(projectId)
+}
+
+// pageName returns the name of the page stored in `file`, e.g. "gitlab/group/project" for "pages/gitlab___group___project".
+func pageName(file string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(file, "pages/"), "___", "/")
+}
@@ -0,0 +1,133 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	git "github.com/xanzy/go-gitlab"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// project is the metadata of a GitLab project the entries are rendered with.
+type project struct {
+	Name string
+	// Path is the path with namespace, e.g. "group/project".
+	Path        string
+	Description string
+	WebURL      string
+	// Fetched is the time the metadata was loaded from GitLab.
+	Fetched time.Time
+}
+
+// loadProjects loads the metadata of the distinct projects of the given IDs up front, so every project is requested
+// once per run. With a project cache TTL, projects cached on disk within the TTL are not requested at all.
+// Projects which cannot be loaded are logged and rendered without name.
+func (c *Connector) loadProjects(ctx context.Context, ids []int) {
+	c.projects = make(map[int]project)
+
+	ttl := c.projectCacheTTL()
+	cached := make(map[int]project)
+	if ttl > 0 {
+		cached = c.readProjectCache()
+	}
+
+	changed := false
+	for _, id := range ids {
+		if _, ok := c.projects[id]; ok {
+			continue
+		}
+		if p, ok := cached[id]; ok && time.Since(p.Fetched) < ttl {
+			c.projects[id] = p
+			continue
+		}
+
+		p, _, err := c.config.Client.Projects.GetProject(id, &git.GetProjectOptions{}, git.WithContext(ctx))
+		if err != nil {
+			log.Printf("%s: failed to get project %d: %v", c.config.Name, id, err)
+			continue
+		}
+
+		c.projects[id] = project{Name: p.Name, Path: p.PathWithNamespace, Description: p.Description, WebURL: p.WebURL, Fetched: time.Now()}
+		cached[id] = c.projects[id]
+		changed = true
+	}
+
+	if ttl > 0 && changed {
+		for id, p := range cached {
+			if time.Since(p.Fetched) >= ttl {
+				delete(cached, id)
+			}
+		}
+		c.writeProjectCache(cached)
+	}
+}
+
+// getGitlabProjectName returns the name of a project loaded by loadProjects, or an empty string.
+func (c *Connector) getGitlabProjectName(projectId int) string {
+	return c.projects[projectId].Name
+}
+
+// projectCacheTTL returns the time projects are cached on disk. Invalid values are rejected by Validate.
+func (c *Connector) projectCacheTTL() time.Duration {
+	ttl, _ := time.ParseDuration(c.config.ProjectCacheTTL)
+	return ttl
+}
+
+// projectCacheFile returns the path of the project cache of the instance in the user cache directory.
+func (c *Connector) projectCacheFile() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "logseq-connector", "gitlab___"+url.PathEscape(c.config.Name)+"___projects.json"), nil
+}
+
+// readProjectCache returns the projects cached on disk. A missing or unreadable cache is empty.
+func (c *Connector) readProjectCache() map[int]project {
+	projects := make(map[int]project)
+
+	file, err := c.projectCacheFile()
+	if err != nil {
+		log.Printf("%s: project cache disabled: %v", c.config.Name, err)
+		return projects
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return projects
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &projects)
+	}
+	if err != nil {
+		log.Printf("%s: failed to read project cache: %v", c.config.Name, err)
+		return make(map[int]project)
+	}
+
+	return projects
+}
+
+// writeProjectCache saves the projects to the cache on disk. Failures are logged, the cache is only an optimization.
+func (c *Connector) writeProjectCache(projects map[int]project) {
+	file, err := c.projectCacheFile()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(file), 0o755)
+	}
+
+	var data []byte
+	if err == nil {
+		data, err = json.MarshalIndent(projects, "", "  ")
+	}
+	if err == nil {
+		err = os.WriteFile(file, data, 0o644)
+	}
+	if err != nil {
+		log.Printf("%s: failed to write project cache: %v", c.config.Name, err)
+	}
+}
@@ -0,0 +1,80 @@
+package jira
+
+import (
+	"Logseq_connector/controller/logseq"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"strings"
+	"time"
+)
+
+// addDescription adds the description of the issue as collapsed child block of the task, below a line with its
+// reporter. The rendered description is converted to markdown; without it, the description is taken as it is, with
+// the lines starting blocks escaped.
+func (c *Connector) addDescription(task *logseq.Block, issue jiraApi.Issue) {
+	var lines []string
+	if issue.RenderedFields != nil && issue.RenderedFields.Description != "" {
+		lines = logseq.FromHTML(issue.RenderedFields.Description)
+	} else if issue.Fields != nil && strings.TrimSpace(issue.Fields.Description) != "" {
+		lines = logseq.EscapeLines(strings.Split(strings.TrimSpace(issue.Fields.Description), "\n"))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	id := c.idPrefix() + issue.Key + "/description"
+
+	block := logseq.ParseBlock("- **Description**\n  collapsed:: true")
+	logseq.SetIdentity(block, id)
+
+	// the first line holds the identity, so it must not be part of the description, which may start with a code fence
+	text := logseq.ParseBlock(descriptionHeader(issue))
+	logseq.SetIdentity(text, id+"/text")
+	text = logseq.ParseBlock(text.String() + indentLines(lines))
+
+	block.AddChild(text)
+	task.AddChild(block)
+}
+
+// descriptionHeader returns the first line of the description text block: the reporter and the creation time of the
+// issue, like the first line of a comment.
+func descriptionHeader(issue jiraApi.Issue) string {
+	header := "- **unknown**"
+	if issue.Fields == nil {
+		return header
+	}
+	if issue.Fields.Reporter != nil {
+		header = "- **" + issue.Fields.Reporter.DisplayName + "**"
+	}
+	if created := time.Time(issue.Fields.Created); !created.IsZero() {
+		header += " *" + created.Local().Format("2006-01-02 15:04") + "*"
+	}
+
+	return header
+}
+
+// addSubtasks adds the subtasks of the issue as child tasks with their own markers.
+func (c *Connector) addSubtasks(task *logseq.Block, issue jiraApi.Issue) {
+	if issue.Fields == nil {
+		return
+	}
+
+	for _, subtask := range issue.Fields.Subtasks {
+		var sub logseq.Task
+		sub.Id = subtask.Key
+		sub.ConfigName = c.config.Name
+		sub.Url = c.config.Url + "browse/" + subtask.Key
+		sub.Title = subtask.Fields.Summary
+		if subtask.Fields.Status != nil {
+			sub.Status = c.config.Marker(subtask.Fields.Status.Name, statusMarkers)
+		}
+		if subtask.Fields.Priority != nil {
+			sub.Priority = c.config.Priority(subtask.Fields.Priority.Name, priorityNumbers)
+		}
+
+		taskLine, _ := logseq.CreateTask(sub)
+		block := logseq.ParseBlock(taskLine)
+		logseq.SetIdentity(block, c.idPrefix()+issue.Key+"/subtask/"+subtask.Key)
+
+		task.AddChild(block)
+	}
+}
@@ -0,0 +1,73 @@
+package jira
+
+import (
+	"Logseq_connector/controller/logseq"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"strings"
+	"testing"
+)
+
+func TestAddDescriptionPlain(t *testing.T) {
+	c := &Connector{config: Config{Name: "work", Description: true}}
+	issue := jiraApi.Issue{Key: "P-1", Fields: &jiraApi.IssueFields{
+		Description: "Steps:\n- open\n  - nested\n\t- tab\nkey:: value\n```\n- code\n```",
+		Reporter:    &jiraApi.User{DisplayName: "Ann"},
+	}}
+
+	want := strings.Join([]string{
+		"  - **Description**",
+		"    collapsed:: true",
+		"    logseq-connector-id:: jira/work/P-1/description",
+		"    id:: " + logseq.BlockUUID("jira/work/P-1/description"),
+		"    - **Ann**",
+		"      logseq-connector-id:: jira/work/P-1/description/text",
+		"      id:: " + logseq.BlockUUID("jira/work/P-1/description/text"),
+		"      Steps:",
+		`      \- open`,
+		`        \- nested`,
+		"      \t\\- tab",
+		`      key\:: value`,
+		"      ```",
+		"      - code",
+		"      ```",
+	}, "\n")
+	if got := renderDescription(c, issue).Content; !strings.HasSuffix(got, want) {
+		t.Fatalf("addDescription() =\n%s\nwant suffix\n%s", got, want)
+	}
+
+	assertStable(t, c, issue)
+}
+
+func TestAddDescriptionCodeFirst(t *testing.T) {
+	c := &Connector{config: Config{Name: "work", Description: true}}
+	issue := jiraApi.Issue{Key: "P-1", Fields: &jiraApi.IssueFields{Description: "```\n- code\n```\ntext"}}
+
+	text := logseq.FindById(logseq.ParsePage(renderDescription(c, issue).Content), "jira/work/P-1/description/text")
+	if text == nil {
+		t.Fatal("description text block not found")
+	}
+	if got, want := text.Body(), []string{"```", "- code", "```", "text"}; strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Body() = %q, want %q", got, want)
+	}
+
+	assertStable(t, c, issue)
+}
+
+// renderDescription returns the entry of a task with the description of the issue.
+func renderDescription(c *Connector, issue jiraApi.Issue) logseq.Entry {
+	task := logseq.ParseBlock("- TODO [[P-1]] task")
+	c.addDescription(task, issue)
+	return logseq.Entry{Content: task.String(), Id: c.idPrefix() + "P-1"}
+}
+
+// assertStable checks that a second sync of the issue leaves the page unchanged.
+func assertStable(t *testing.T, c *Connector, issue jiraApi.Issue) {
+	t.Helper()
+
+	page := &logseq.TaskPage{Entries: []logseq.Entry{renderDescription(c, issue)}}
+	first := page.Update("")
+	page.Entries = []logseq.Entry{renderDescription(c, issue)}
+	if second := page.Update(first); second != first {
+		t.Errorf("second sync changed the page:\n%s\nwant\n%s", second, first)
+	}
+}
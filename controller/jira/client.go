@@ -0,0 +1,250 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"github.com/andygrunwald/go-jira/v2/onpremise"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Flavors of Jira, see Config.Flavor.
+const (
+	FlavorCloud  = "cloud"
+	FlavorServer = "server"
+)
+
+// client is the part of the Jira API used by the connector. Jira Cloud and Jira Server / Data Center are accessed with
+// the go-jira client of their flavor; the results are Cloud types in both cases, so the tasks are rendered the same.
+type client interface {
+	fields(ctx context.Context) ([]jiraApi.Field, error)
+	// search returns the page of the issues of the query starting at `token`, the first page for an empty token, and
+	// the token of the next page, which is empty on the last page.
+	search(ctx context.Context, jql string, options *jiraApi.SearchOptions, token string) ([]jiraApi.Issue, string, error)
+	transitions(ctx context.Context, key string) ([]jiraApi.Transition, error)
+	doTransition(ctx context.Context, key string, transitionID string) error
+	currentUser(ctx context.Context) (*jiraApi.User, error)
+	create(ctx context.Context, issue *jiraApi.Issue) (*jiraApi.Issue, error)
+	addComment(ctx context.Context, key string, comment *jiraApi.Comment) (*jiraApi.Comment, error)
+	// assignee returns the value of the assignee field assigning an issue to the user.
+	assignee(user *jiraApi.User) map[string]string
+}
+
+// getClient creates the Jira client of the instance. Jira Cloud authenticates with username and API token, Jira Server
+// with the token as personal access token.
+func (c *Connector) getClient() (client, error) {
+	if c.flavor() == FlavorServer {
+		tp := onpremise.PATAuthTransport{Token: c.config.Token}
+		jiraClient, err := onpremise.NewClient(c.config.Url, tp.Client())
+		if err != nil {
+			return nil, err
+		}
+
+		return serverClient{jiraClient}, nil
+	}
+
+	tp := jiraApi.BasicAuthTransport{
+		Username: c.config.Username,
+		APIToken: c.config.Token,
+	}
+	jiraClient, err := jiraApi.NewClient(c.config.Url, tp.Client())
+	if err != nil {
+		return nil, err
+	}
+
+	return cloudClient{jiraClient}, nil
+}
+
+// cloudClient accesses Jira Cloud.
+type cloudClient struct {
+	client *jiraApi.Client
+}
+
+func (j cloudClient) fields(ctx context.Context) ([]jiraApi.Field, error) {
+	fields, _, err := j.client.Field.GetList(ctx)
+	return fields, err
+}
+
+// search uses the enhanced search of Jira Cloud, which pages with a token instead of an offset. go-jira only supports
+// the former search, which Jira Cloud no longer serves.
+func (j cloudClient) search(ctx context.Context, jql string, options *jiraApi.SearchOptions, token string) ([]jiraApi.Issue, string, error) {
+	fields := options.Fields
+	if len(fields) == 0 {
+		// the enhanced search only returns the IDs by default
+		fields = []string{"*navigable"}
+	}
+
+	query := url.Values{}
+	query.Set("jql", jql)
+	query.Set("fields", strings.Join(fields, ","))
+	if options.MaxResults > 0 {
+		query.Set("maxResults", strconv.Itoa(options.MaxResults))
+	}
+	if options.Expand != "" {
+		query.Set("expand", options.Expand)
+	}
+	if token != "" {
+		query.Set("nextPageToken", token)
+	}
+
+	req, err := j.client.NewRequest(ctx, http.MethodGet, "rest/api/2/search/jql?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var result struct {
+		Issues        []jiraApi.Issue `json:"issues"`
+		NextPageToken string          `json:"nextPageToken"`
+		IsLast        bool            `json:"isLast"`
+	}
+	if _, err := j.client.Do(req, &result); err != nil {
+		return nil, "", err
+	}
+	if result.IsLast {
+		return result.Issues, "", nil
+	}
+
+	return result.Issues, result.NextPageToken, nil
+}
+
+func (j cloudClient) transitions(ctx context.Context, key string) ([]jiraApi.Transition, error) {
+	transitions, _, err := j.client.Issue.GetTransitions(ctx, key)
+	return transitions, err
+}
+
+func (j cloudClient) doTransition(ctx context.Context, key string, transitionID string) error {
+	_, err := j.client.Issue.DoTransition(ctx, key, transitionID)
+	return err
+}
+
+func (j cloudClient) currentUser(ctx context.Context) (*jiraApi.User, error) {
+	user, _, err := j.client.User.GetCurrentUser(ctx)
+	return user, err
+}
+
+func (j cloudClient) create(ctx context.Context, issue *jiraApi.Issue) (*jiraApi.Issue, error) {
+	created, _, err := j.client.Issue.Create(ctx, issue)
+	return created, err
+}
+
+func (j cloudClient) addComment(ctx context.Context, key string, comment *jiraApi.Comment) (*jiraApi.Comment, error) {
+	added, _, err := j.client.Issue.AddComment(ctx, key, comment)
+	return added, err
+}
+
+func (j cloudClient) assignee(user *jiraApi.User) map[string]string {
+	return map[string]string{"accountId": user.AccountID}
+}
+
+// serverClient accesses Jira Server and Data Center. The requests and results are converted from and to the Cloud
+// types, which share their JSON representation.
+type serverClient struct {
+	client *onpremise.Client
+}
+
+func (j serverClient) fields(ctx context.Context) ([]jiraApi.Field, error) {
+	fields, _, err := j.client.Field.GetList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted []jiraApi.Field
+	return converted, convert(fields, &converted)
+}
+
+// search pages by offset, the token is the index of the first issue of the page.
+func (j serverClient) search(ctx context.Context, jql string, options *jiraApi.SearchOptions, token string) ([]jiraApi.Issue, string, error) {
+	serverOptions := onpremise.SearchOptions(*options)
+	if token != "" {
+		startAt, err := strconv.Atoi(token)
+		if err != nil {
+			return nil, "", err
+		}
+		serverOptions.StartAt = startAt
+	}
+
+	issues, resp, err := j.client.Issue.Search(ctx, jql, &serverOptions)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if end := serverOptions.StartAt + len(issues); len(issues) > 0 && end < resp.Total {
+		next = strconv.Itoa(end)
+	}
+
+	var converted []jiraApi.Issue
+	return converted, next, convert(issues, &converted)
+}
+
+func (j serverClient) transitions(ctx context.Context, key string) ([]jiraApi.Transition, error) {
+	transitions, _, err := j.client.Issue.GetTransitions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted []jiraApi.Transition
+	return converted, convert(transitions, &converted)
+}
+
+func (j serverClient) doTransition(ctx context.Context, key string, transitionID string) error {
+	_, err := j.client.Issue.DoTransition(ctx, key, transitionID)
+	return err
+}
+
+func (j serverClient) currentUser(ctx context.Context) (*jiraApi.User, error) {
+	user, _, err := j.client.User.GetSelf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted jiraApi.User
+	return &converted, convert(user, &converted)
+}
+
+func (j serverClient) create(ctx context.Context, issue *jiraApi.Issue) (*jiraApi.Issue, error) {
+	// posted as Cloud issue, as the assignee would be sent with all user fields after the conversion
+	req, err := j.client.NewRequest(ctx, http.MethodPost, "rest/api/2/issue", issue)
+	if err != nil {
+		return nil, err
+	}
+
+	var created jiraApi.Issue
+	if _, err := j.client.Do(req, &created); err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+func (j serverClient) addComment(ctx context.Context, key string, comment *jiraApi.Comment) (*jiraApi.Comment, error) {
+	var serverComment onpremise.Comment
+	if err := convert(comment, &serverComment); err != nil {
+		return nil, err
+	}
+
+	added, _, err := j.client.Issue.AddComment(ctx, key, &serverComment)
+	if err != nil {
+		return nil, err
+	}
+
+	var converted jiraApi.Comment
+	return &converted, convert(added, &converted)
+}
+
+func (j serverClient) assignee(user *jiraApi.User) map[string]string {
+	return map[string]string{"name": user.Name}
+}
+
+// convert copies `from` into `to`, a value of the corresponding type of the other flavor, through their JSON.
+func convert(from interface{}, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, to)
+}
@@ -0,0 +1,164 @@
+package jira
+
+import (
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/logseq"
+	"context"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commentTag matches the tag of a child block which is posted as a new comment, written as #comment or #[[comment]].
+var commentTag = regexp.MustCompile(`(?i)(?:^|\s)#(?:\[\[comment]]|comment)(?:\s|$)`)
+
+// jiraTime is the format of the timestamps in the Jira REST API.
+const jiraTime = "2006-01-02T15:04:05.000-0700"
+
+// addComments adds the comments of the issue as child blocks of the task, oldest first. The author and the time are
+// the first line of a comment block, the rendered body converted to markdown follows below.
+func (c *Connector) addComments(task *logseq.Block, issue jiraApi.Issue) {
+	if issue.Fields == nil || issue.Fields.Comments == nil {
+		return
+	}
+
+	rendered := make(map[string]string)
+	if issue.RenderedFields != nil && issue.RenderedFields.Comments != nil {
+		for _, comment := range issue.RenderedFields.Comments.Comments {
+			rendered[comment.ID] = comment.Body
+		}
+	}
+
+	for _, comment := range issue.Fields.Comments.Comments {
+		author := "unknown"
+		if comment.Author != nil {
+			author = comment.Author.DisplayName
+		}
+
+		created := comment.Created
+		if t, err := time.Parse(jiraTime, comment.Created); err == nil {
+			created = t.Local().Format("2006-01-02 15:04")
+		}
+
+		block := logseq.ParseBlock("- **" + author + "** *" + created + "*")
+		logseq.SetIdentity(block, c.commentId(issue.Key, comment.ID))
+		block = logseq.ParseBlock(block.String() + indentLines(logseq.FromHTML(rendered[comment.ID])))
+
+		task.AddChild(block)
+	}
+}
+
+// postComments posts every child block tagged #comment of a synced task on the Jira pages as comment of its issue.
+// The returned pages turn the posted blocks into synced comments, which the following sync renders from Jira.
+func (c *Connector) postComments(ctx context.Context, jiraClient client, graph fs.FS) ([]connector.Page, error) {
+	pages, err := c.readPages(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(pages))
+	for file := range pages {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var updates []connector.Page
+	for _, file := range files {
+		// posted maps the position of every posted block to the identity of its comment, per task
+		posted := make(map[string]map[int]string)
+		for _, task := range pages[file].Blocks {
+			key, ok := strings.CutPrefix(logseq.Identity(task), c.idPrefix())
+			if !ok {
+				continue
+			}
+
+			for i, child := range task.Children {
+				if !isNewComment(child) {
+					continue
+				}
+
+				comment, err := jiraClient.addComment(ctx, key, &jiraApi.Comment{Body: commentText(child)})
+				if err != nil {
+					log.Printf("%s: failed to comment on %s: %v", c.config.Name, key, err)
+					continue
+				}
+
+				if posted[logseq.Identity(task)] == nil {
+					posted[logseq.Identity(task)] = make(map[int]string)
+				}
+				posted[logseq.Identity(task)][i] = c.commentId(key, comment.ID)
+			}
+		}
+
+		if len(posted) > 0 {
+			updates = append(updates, connector.Page{File: file + ".md", Update: markPosted(posted)})
+		}
+	}
+
+	return updates, nil
+}
+
+// isNewComment reports whether the child block of a task is tagged to be posted as comment and was not posted yet.
+func isNewComment(child *logseq.Block) bool {
+	return logseq.Identity(child) == "" && commentTag.MatchString(child.Content())
+}
+
+// commentText returns the text of a comment block without the tag. Lines Logseq reads as properties are part of the
+// comment, except for the ones Logseq and the connector manage, e.g. `id::`.
+func commentText(child *logseq.Block) string {
+	lines := []string{strings.TrimSpace(commentTag.ReplaceAllString(child.Content(), " "))}
+	for _, key := range child.Properties() {
+		if !logseq.IsReservedProperty(key) {
+			value, _ := child.Property(key)
+			lines = append(lines, key+":: "+value)
+		}
+	}
+	lines = append(lines, child.Body()...)
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// markPosted returns the update of a Jira page which turns the posted comment blocks, by their position below the
+// task, into synced comments.
+func markPosted(posted map[string]map[int]string) func(string) string {
+	return func(fileContent string) string {
+		page := logseq.ParsePage(fileContent)
+		for taskId, comments := range posted {
+			task := logseq.FindById(page, taskId)
+			if task == nil {
+				continue
+			}
+
+			for i, child := range task.Children {
+				if id, ok := comments[i]; ok && isNewComment(child) {
+					child.SetContent(strings.TrimSpace(commentTag.ReplaceAllString(child.Content(), " ")))
+					logseq.SetIdentity(child, id)
+				}
+			}
+		}
+
+		return page.String()
+	}
+}
+
+// commentId returns the identity of a comment, scoped below the identity of its issue.
+func (c *Connector) commentId(key string, commentID string) string {
+	return c.idPrefix() + key + "/comment/" + commentID
+}
+
+// indentLines formats lines as content lines of a block, each on its own line.
+func indentLines(lines []string) string {
+	var sb strings.Builder
+	for _, line := range lines {
+		sb.WriteString("\n")
+		if line != "" {
+			sb.WriteString("  " + line)
+		}
+	}
+
+	return sb.String()
+}
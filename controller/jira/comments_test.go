@@ -0,0 +1,68 @@
+package jira
+
+import (
+	"Logseq_connector/controller/logseq"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPostComments(t *testing.T) {
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/P-1/comment" {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+
+		var comment struct{ Body string }
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		posted = append(posted, comment.Body)
+		_ = json.NewEncoder(w).Encode(map[string]string{"id": strconv.Itoa(len(posted))})
+	}))
+	defer server.Close()
+
+	c := &Connector{config: Config{Name: "work", Url: server.URL + "/", Username: "u", Token: "t", Comments: true, PostComments: true}}
+	jiraClient, err := c.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := strings.Join([]string{
+		"- TODO [[P-1]] task",
+		"  logseq-connector-id:: jira/work/P-1",
+		"  - +1 #comment",
+		"  - +1 #comment",
+		"  - see #comment",
+		"    key:: value",
+		"    id:: 1234",
+		"    more",
+		"",
+	}, "\n")
+	graph := fstest.MapFS{"pages/jira___work.md": {Data: []byte(content)}}
+
+	pages, err := c.postComments(context.Background(), jiraClient, graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"+1", "+1", "see\nkey:: value\nmore"}; strings.Join(posted, "|") != strings.Join(want, "|") {
+		t.Errorf("posted %q, want %q", posted, want)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+
+	page := logseq.ParsePage(pages[0].Update(content))
+	for i, child := range page.Blocks[0].Children {
+		if want := c.commentId("P-1", strconv.Itoa(i+1)); logseq.Identity(child) != want {
+			t.Errorf("identity of comment %d = %q, want %q", i, logseq.Identity(child), want)
+		}
+	}
+}
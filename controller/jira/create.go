@@ -0,0 +1,291 @@
+package jira
+
+import (
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/logseq"
+	"context"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"io/fs"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// draftTag matches the tag of a block which is created as a new Jira issue, written as #jira/new or #[[jira/new]].
+var draftTag = regexp.MustCompile(`(?i)(?:^|\s)#(?:\[\[jira/new]]|jira/new)(?:\s|$)`)
+
+// draft is a block tagged as new issue in a page of the graph.
+type draft struct {
+	// file is the path of the page relative to the graph.
+	file string
+	// id is the block UUID of the draft, which finds it again when the page is rewritten, or empty.
+	id    string
+	block *logseq.Block
+}
+
+// createIssues creates an issue for every block tagged #jira/new with `project::` and `type::` properties in the
+// journals and pages of the graph. A block with a `jira::` property is only created by the instance of that name.
+// A draft without `id::` property gets one first and is created by the next push, so it is found again after edits
+// and once its issue was created. The returned pages record the key of the created issue on the draft first, so a
+// later push does not create it again if the following writes fail. They then move the blocks as pending synced tasks
+// to the page of the first query and leave a block reference in their place.
+func (c *Connector) createIssues(ctx context.Context, jiraClient client, graph fs.FS) ([]connector.Page, error) {
+	drafts, err := c.findDrafts(graph)
+	if err != nil || len(drafts) == 0 {
+		return nil, err
+	}
+
+	// the drafts getting an id, by their first line, the keys of the issues created now and the block references
+	// replacing the created drafts, by the id of the draft
+	unmarked := make(map[string][]string)
+	created := make(map[string]map[string]string)
+	refs := make(map[string]map[string]*logseq.Block)
+
+	var me *jiraApi.User
+	var createErr error
+	var moved []*logseq.Block
+	for _, d := range drafts {
+		if d.id == "" {
+			unmarked[d.file] = append(unmarked[d.file], d.block.Content())
+			continue
+		}
+
+		key := c.createdKey(d.block)
+		if key == "" {
+			if me == nil && createErr == nil {
+				me, createErr = jiraClient.currentUser(ctx)
+			}
+			if createErr != nil {
+				continue
+			}
+
+			if key, err = c.createIssue(ctx, jiraClient, d.block, me); err != nil {
+				log.Printf("%s: failed to create issue %q: %v", c.config.Name, d.block.Content(), err)
+				continue
+			}
+			addDraft(created, d, key)
+		}
+
+		moved = append(moved, c.syncedBlock(d.block, key))
+		addDraft(refs, d, logseq.ParseBlock("- (("+d.id+"))"))
+	}
+
+	var files []string
+	for _, d := range drafts {
+		if len(files) == 0 || files[len(files)-1] != d.file {
+			files = append(files, d.file)
+		}
+	}
+
+	var pages []connector.Page
+	for _, file := range files {
+		if len(unmarked[file]) == 0 && len(created[file]) == 0 {
+			continue
+		}
+
+		pages = append(pages, connector.Page{
+			File: file,
+			Update: func(fileContent string) string {
+				page := logseq.ParsePage(fileContent)
+				for _, content := range unmarked[file] {
+					b := page.Find(func(b *logseq.Block) bool {
+						_, hasId := b.Property("id")
+						return !hasId && b.Content() == content
+					})
+					if b != nil {
+						b.SetProperty("id", logseq.NewBlockUUID())
+					}
+				}
+
+				for id, key := range created[file] {
+					if b := findDraft(page, id); b != nil {
+						b.SetProperty(logseq.IdProperty, c.idPrefix()+key)
+					}
+				}
+
+				return page.String()
+			},
+		})
+	}
+
+	if len(moved) > 0 {
+		pages = append(pages, connector.Page{
+			File: c.pageFile(c.queries()[0]) + ".md",
+			Update: func(fileContent string) string {
+				page := logseq.ParsePage(fileContent)
+				for _, b := range moved {
+					if logseq.FindById(page, logseq.Identity(b)) == nil {
+						page.Blocks = append([]*logseq.Block{b}, page.Blocks...)
+					}
+				}
+
+				return page.String()
+			},
+		})
+	}
+
+	for _, file := range files {
+		if len(refs[file]) == 0 {
+			continue
+		}
+
+		pages = append(pages, connector.Page{
+			File: file,
+			Update: func(fileContent string) string {
+				page := logseq.ParsePage(fileContent)
+				for id, ref := range refs[file] {
+					if b := findDraft(page, id); b != nil {
+						ref.SetIndent(b.Indent)
+						*b = *ref
+					}
+				}
+
+				return page.String()
+			},
+		})
+	}
+
+	return pages, createErr
+}
+
+// addDraft adds the value for the draft to the values by file and draft id.
+func addDraft[V any](values map[string]map[string]V, d draft, value V) {
+	if values[d.file] == nil {
+		values[d.file] = make(map[string]V)
+	}
+	values[d.file][d.id] = value
+}
+
+// findDraft returns the block with the `id::` in the page, or nil.
+func findDraft(page *logseq.Page, id string) *logseq.Block {
+	return page.Find(func(b *logseq.Block) bool {
+		blockId, _ := b.Property("id")
+		return blockId == id
+	})
+}
+
+// createdKey returns the key of the issue an earlier push created for the draft, which it recorded as identity of the
+// draft, or an empty string.
+func (c *Connector) createdKey(b *logseq.Block) string {
+	key, ok := strings.CutPrefix(logseq.Identity(b), c.idPrefix())
+	if !ok {
+		return ""
+	}
+
+	return key
+}
+
+// findDrafts returns the blocks tagged as new issue for this instance in the journals and pages of the graph.
+// Drafts nested in another draft are moved together with it and not created on their own.
+func (c *Connector) findDrafts(graph fs.FS) ([]draft, error) {
+	var drafts []draft
+	for _, pattern := range []string{"journals/*.md", "pages/*.md"} {
+		files, err := fs.Glob(graph, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			content, err := fs.ReadFile(graph, file)
+			if err != nil {
+				return nil, err
+			}
+			if !draftTag.Match(content) {
+				continue
+			}
+
+			var walk func(blocks []*logseq.Block)
+			walk = func(blocks []*logseq.Block) {
+				for _, b := range blocks {
+					if c.isDraft(b) {
+						id, _ := b.Property("id")
+						drafts = append(drafts, draft{file: file, id: id, block: b})
+						continue
+					}
+					walk(b.Children)
+				}
+			}
+			walk(logseq.ParsePage(string(content)).Blocks)
+		}
+	}
+
+	return drafts, nil
+}
+
+// isDraft reports whether the block is tagged as new issue, has the required properties and belongs to this instance.
+func (c *Connector) isDraft(b *logseq.Block) bool {
+	if !draftTag.MatchString(b.Content()) {
+		return false
+	}
+	if instance, ok := b.Property("jira"); ok && unlink(instance) != c.config.Name {
+		return false
+	}
+
+	_, hasProject := b.Property("project")
+	_, hasType := b.Property("type")
+
+	return hasProject && hasType
+}
+
+// createIssue creates the issue described by the draft block, assigned to the user, and returns its key.
+// The block content is the summary, the lines below its properties are the description.
+func (c *Connector) createIssue(ctx context.Context, jiraClient client, b *logseq.Block, assignee *jiraApi.User) (string, error) {
+	project, _ := b.Property("project")
+	issueType, _ := b.Property("type")
+
+	issue := &jiraApi.Issue{
+		Fields: &jiraApi.IssueFields{
+			Project:     jiraApi.Project{Key: unlink(project)},
+			Type:        jiraApi.IssueType{Name: unlink(issueType)},
+			Summary:     draftTitle(b),
+			Description: strings.TrimSpace(strings.Join(b.Body(), "\n")),
+			// set as unknown field, as the User struct would be sent with all its fields
+			Unknowns: map[string]interface{}{"assignee": jiraClient.assignee(assignee)},
+		},
+	}
+
+	created, err := jiraClient.create(ctx, issue)
+	if err != nil {
+		return "", err
+	}
+
+	return created.Key, nil
+}
+
+// syncedBlock turns the draft block into the synced task of the new issue, pending until a query returns it. The
+// children and all properties except the ones used for creating the issue are kept, including the `id::` of the draft.
+func (c *Connector) syncedBlock(b *logseq.Block, key string) *logseq.Block {
+	project, _ := b.Property("project")
+
+	taskLine, _ := logseq.CreateTask(logseq.Task{
+		Id:         key,
+		ConfigName: c.config.Name,
+		Status:     "TODO",
+		Project:    unlink(project),
+		Url:        c.config.Url + "browse/" + key,
+		Title:      draftTitle(b),
+	})
+
+	for _, property := range []string{"project", "type", "jira"} {
+		b.RemoveProperty(property)
+	}
+
+	block := logseq.MergeBlock(b, logseq.ParseBlock(taskLine), logseq.TaskProperties)
+	block.SetIndent("")
+	logseq.SetIdentity(block, c.idPrefix()+key)
+	block.SetProperty(logseq.PendingProperty, "true")
+
+	return block
+}
+
+// draftTitle returns the content of the draft block without its marker and the new issue tag.
+func draftTitle(b *logseq.Block) string {
+	title := strings.TrimPrefix(b.Content(), b.Marker())
+
+	return strings.Join(strings.Fields(draftTag.ReplaceAllString(title, " ")), " ")
+}
+
+// unlink removes the brackets of a page link, so `[[PROJ]]` can be used as property value as well.
+func unlink(value string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "[["), "]]")
+}
@@ -0,0 +1,99 @@
+package jira
+
+import (
+	"Logseq_connector/controller/logseq"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCreateIssues(t *testing.T) {
+	var created []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/3/myself":
+			_ = json.NewEncoder(w).Encode(map[string]string{"accountId": "me"})
+		case "/rest/api/2/issue":
+			var issue struct {
+				Fields struct{ Summary string }
+			}
+			_ = json.NewDecoder(r.Body).Decode(&issue)
+			created = append(created, issue.Fields.Summary)
+			_ = json.NewEncoder(w).Encode(map[string]string{"key": "P-1"})
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := &Connector{config: Config{Name: "work", Url: server.URL + "/", Username: "u", Token: "t", Create: true}}
+	jiraClient, err := c.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks string
+	journal := "- TODO new task #jira/new\n  project:: P\n  type:: Task\n  - my note\n"
+	// push runs createIssues and writes the first `writes` of the returned pages, all for -1
+	push := func(content string, writes int) string {
+		graph := fstest.MapFS{"journals/2024_01_02.md": {Data: []byte(content)}}
+		pages, err := c.createIssues(context.Background(), jiraClient, graph)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, page := range pages {
+			if i == writes {
+				break
+			}
+			switch page.File {
+			case "journals/2024_01_02.md":
+				content = page.Update(content)
+			case "pages/jira___work.md":
+				tasks = page.Update(tasks)
+			}
+		}
+		return content
+	}
+
+	// the first push only marks the draft
+	marked := push(journal, -1)
+	if len(created) != 0 {
+		t.Fatalf("created %q before the draft had an id", created)
+	}
+	id, ok := logseq.ParsePage(marked).Blocks[0].Property("id")
+	if !ok {
+		t.Fatalf("draft not marked:\n%s", marked)
+	}
+
+	// the draft is found by its id after it was edited, and the run is interrupted after recording the issue key
+	edited := strings.Replace(marked, "new task", "renamed task", 1)
+	interrupted := push(edited, 1)
+	if !strings.Contains(interrupted, logseq.IdProperty+":: jira/work/P-1\n") || tasks != "" {
+		t.Fatalf("journal =\n%s\nwant the key recorded on the draft", interrupted)
+	}
+
+	// the next push moves the draft without creating the issue again
+	if got := push(interrupted, -1); got != "- (("+id+"))\n" {
+		t.Errorf("journal =\n%s\nwant the block reference", got)
+	}
+	if len(created) != 1 || created[0] != "renamed task" {
+		t.Errorf("created %q", created)
+	}
+
+	block := logseq.FindById(logseq.ParsePage(tasks), "jira/work/P-1")
+	if block == nil {
+		t.Fatalf("task page =\n%s\nwant the created task", tasks)
+	}
+	if blockId, _ := block.Property("id"); blockId != id {
+		t.Errorf("id of the created task = %q, want %q", blockId, id)
+	}
+	if _, ok := block.Property(logseq.PendingProperty); !ok || len(block.Children) != 1 {
+		t.Errorf("created task =\n%s\nwant it pending with its child", block)
+	}
+}
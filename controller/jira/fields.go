@@ -0,0 +1,155 @@
+package jira
+
+import (
+	"Logseq_connector/controller/logseq"
+	"encoding/json"
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// propertyName matches the names which can be used as block property.
+var propertyName = regexp.MustCompile(`^[\w-]+$`)
+
+// sprintName matches the name in the string representation of a sprint, as Jira Server returns it for the Sprint field.
+var sprintName = regexp.MustCompile(`\[.*\bname=([^,\]]*)`)
+
+// property is a Jira field rendered as block property of the tasks.
+type property struct {
+	name string
+	// key is the key of the field in the issue.
+	key string
+}
+
+// properties resolves the configured fields to their keys, ordered by property name. Fields which do not exist in
+// Jira are logged and skipped.
+func (c *Connector) properties(fields []jiraApi.Field) []property {
+	var properties []property
+	for name, prop := range c.config.Fields {
+		key := getFieldKey(name, fields)
+		if key == "" {
+			log.Printf("%s: field %q not found", c.config.Name, name)
+			continue
+		}
+		properties = append(properties, property{name: prop, key: key})
+	}
+
+	sort.Slice(properties, func(i, j int) bool {
+		return properties[i].name < properties[j].name
+	})
+
+	return properties
+}
+
+// owned returns the properties rendered for a task, which are replaced on every sync.
+func (c *Connector) owned() []string {
+	owned := append([]string{}, logseq.TaskProperties...)
+	for _, prop := range c.config.Fields {
+		owned = append(owned, prop)
+	}
+
+	return owned
+}
+
+// setProperties sets the properties of the task to the values of their fields. Empty fields are left out.
+func setProperties(task *logseq.Block, issue jiraApi.Issue, properties []property) {
+	if len(properties) == 0 {
+		return
+	}
+
+	values := fieldValues(issue.Fields)
+	for _, prop := range properties {
+		if value := fieldValue(values[prop.key]); value != "" {
+			task.SetProperty(prop.name, value)
+		}
+	}
+}
+
+// fieldValues returns the raw JSON values of all fields of the issue by their key, system and custom fields.
+func fieldValues(fields *jiraApi.IssueFields) map[string]interface{} {
+	values := make(map[string]interface{})
+	if fields == nil {
+		return values
+	}
+
+	// the plain type marshals the system fields with their JSON names instead of using the custom marshaller
+	type plain jiraApi.IssueFields
+	if data, err := json.Marshal((*plain)(fields)); err == nil {
+		_ = json.Unmarshal(data, &values)
+	}
+	delete(values, "Unknowns")
+
+	for key, value := range fields.Unknowns {
+		values[key] = value
+	}
+
+	return values
+}
+
+// fieldValue renders a field value as property value. Users become page links, option, version, component and sprint
+// objects their value or name, arrays a comma-separated list and timestamps a local date and time.
+func fieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return stringValue(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			if s := fieldValue(item); s != "" {
+				items = append(items, s)
+			}
+		}
+		return strings.Join(items, ", ")
+	case map[string]interface{}:
+		return objectValue(v)
+	}
+
+	return ""
+}
+
+// objectValue renders a Jira object, e.g. a user or an option, by its most descriptive attribute.
+func objectValue(object map[string]interface{}) string {
+	if name, ok := object["displayName"].(string); ok && name != "" {
+		return "[[" + name + "]]"
+	}
+	if value, ok := object["value"].(string); ok {
+		// the child of a cascading select
+		if child := fieldValue(object["child"]); child != "" {
+			return value + " / " + child
+		}
+		return value
+	}
+	for _, attribute := range []string{"name", "key"} {
+		if s, ok := object[attribute].(string); ok && s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// stringValue renders a string field on a single line, timestamps in local time.
+func stringValue(s string) string {
+	if strings.HasPrefix(s, "0001-01-01") {
+		// an unset date or time field
+		return ""
+	}
+	if t, err := time.Parse(jiraTime, s); err == nil {
+		return t.Local().Format("2006-01-02 15:04")
+	}
+	if match := sprintName.FindStringSubmatch(s); match != nil {
+		return match[1]
+	}
+
+	return strings.Join(strings.Fields(s), " ")
+}
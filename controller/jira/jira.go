@@ -1,12 +1,15 @@
 package jira
 
 import (
-	"Logseq_connector/controller/fileFunctions"
+	"Logseq_connector/controller/connector"
 	"Logseq_connector/controller/logseq"
 	"context"
+	"errors"
+	"fmt"
 	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"io/fs"
 	"log"
-	"os"
+	"strings"
 )
 
 // Config represents configuration details for connecting to external systems such as Jira or similar services.
@@ -16,124 +19,466 @@ type Config struct {
 	Url      string
 	Username string
 	Token    string
+	// Flavor is FlavorCloud (default) or FlavorServer for Jira Server and Data Center, where Token is a personal
+	// access token.
+	Flavor string
+	Stale  logseq.StaleConfig
+	// WriteBack enables transitions of issues whose marker was changed in Logseq.
+	WriteBack bool
+	// Transitions maps a Logseq marker to the name of the Jira transition performed for it.
+	Transitions map[string]string
+	// Create enables creating issues from blocks tagged #jira/new.
+	Create bool
+	// Description enables rendering the description of an issue as collapsed child block.
+	Description bool
+	// Subtasks enables rendering the subtasks of an issue as child tasks.
+	Subtasks bool
+	// Comments enables rendering the comments of an issue as child blocks.
+	Comments bool
+	// PostComments enables posting child blocks tagged #comment as new comments.
+	PostComments bool
+	// Jql replaces the default query for the open issues assigned to the user.
+	Jql string
+	// Queries are named queries, each written to its own page. They replace Jql.
+	Queries []Query
+	// Limit is the maximum number of issues synced per query, see defaultLimit.
+	Limit int
+	// Fields maps the names of Jira fields, e.g. "Story Points", to the block properties they are rendered as.
+	Fields map[string]string
+	// Mapping overrides or extends statusMarkers and priorityNumbers.
+	logseq.Mapping
 }
 
-var config Config
+// Query is a named JQL query whose issues are written to their own page.
+type Query struct {
+	Name string
+	Jql  string
+}
+
+// defaultLimit is the maximum number of issues synced per query if no limit is configured.
+const defaultLimit = 1000
+
+// searchPageSize is the number of issues requested per search request.
+const searchPageSize = 100
+
+// Connector synchronizes the issues of one Jira instance returned by its queries.
+type Connector struct {
+	config  Config
+	results []result
+}
+
+// result are the entries fetched for a query.
+type result struct {
+	query   Query
+	entries []logseq.Entry
+	// partial reports that the issues of the query were cut off by the limit.
+	partial bool
+}
 
-// Process retrieves issues from Jira based on the provided configuration, formats them into tasks, and writes them to a file.
-func Process(extConf Config, path string) {
-	config = extConf
+func init() {
+	connector.Register("jira", connector.Instances(New))
+}
 
-	tp := jiraApi.BasicAuthTransport{
-		Username: config.Username,
-		APIToken: config.Token,
+// New creates a Jira connector for the given instance configuration.
+func New(extConf Config) connector.Connector {
+	return &Connector{config: extConf}
+}
+
+// Name returns the configured instance name.
+func (c *Connector) Name() string {
+	return c.config.Name
+}
+
+// Graph returns the key of the graph the issues are written to.
+func (c *Connector) Graph() string {
+	return c.config.Graph
+}
+
+// Validate checks that all required settings of the instance are present.
+func (c *Connector) Validate() error {
+	switch {
+	case c.config.Name == "":
+		return errors.New("name is required")
+	case c.config.Url == "":
+		return errors.New("url is required")
+	case c.config.Username == "" && c.flavor() != FlavorServer:
+		return errors.New("username is required")
+	case c.config.Username == "" && c.config.Jql == "" && len(c.config.Queries) == 0:
+		return errors.New("username is required for the default query")
+	case c.config.Token == "":
+		return errors.New("token is required")
+	case c.config.PostComments && !c.config.Comments:
+		return errors.New("postComments requires comments")
+	case c.config.Limit < 0:
+		return errors.New("limit must not be negative")
+	case c.flavor() != FlavorCloud && c.flavor() != FlavorServer:
+		return errors.New("flavor must be cloud or server")
 	}
-	jiraClient, err := jiraApi.NewClient(config.Url, tp.Client())
-	if err != nil {
-		panic(err)
+
+	for name, prop := range c.config.Fields {
+		if !propertyName.MatchString(prop) {
+			return errors.New("property " + prop + " of field " + name + " must only contain letters, digits, - and _")
+		}
+		if logseq.IsReservedProperty(prop) {
+			return errors.New("property " + prop + " of field " + name + " is reserved")
+		}
 	}
 
-	fields, _, err := jiraClient.Field.GetList(context.Background())
-	if err != nil {
-		panic(err)
+	names := make(map[string]bool)
+	for _, query := range c.config.Queries {
+		switch {
+		case query.Name == "":
+			return errors.New("name of query is required")
+		case strings.ContainsAny(query.Name, `/\`):
+			return errors.New("name of query " + query.Name + " must not contain slashes")
+		case query.Jql == "":
+			return errors.New("jql of query " + query.Name + " is required")
+		case names[strings.ToLower(query.Name)]:
+			return errors.New("duplicate query " + query.Name)
+		}
+		names[strings.ToLower(query.Name)] = true
+	}
+
+	if err := c.config.Mapping.Validate(); err != nil {
+		return err
 	}
 
-	jql := "assignee=\"" + config.Username + "\" AND status NOT IN (Done,Canceled,Closed,Completed)"
+	return c.config.Stale.Validate()
+}
 
-	options := &jiraApi.SearchOptions{Expand: "renderedFields"}
-	issues, _, err := jiraClient.Issue.Search(context.Background(), jql, options)
+// Fetch retrieves the issues of every query from Jira and formats them into tasks. An issue returned by several
+// queries is only listed on the page of the first one.
+func (c *Connector) Fetch(ctx context.Context) error {
+	jiraClient, err := c.getClient()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	var fileContent string
+	fields, err := jiraClient.fields(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get fields: %w", err)
+	}
 
 	field := getFieldKey("Target end", fields)
+	properties := c.properties(fields)
+
+	var results []result
+	seen := make(map[string]bool)
+	for _, query := range c.queries() {
+		issues, partial, err := c.search(ctx, jiraClient, query.Jql)
+		if err != nil {
+			return fmt.Errorf("failed to search issues of %s: %w", query.Jql, err)
+		}
+
+		r := result{query: query, partial: partial}
+		for _, i := range issues {
+			if !seen[i.Key] {
+				seen[i.Key] = true
+				r.entries = append(r.entries, c.createEntry(i, field, properties))
+			}
+		}
+		results = append(results, r)
+	}
+
+	c.results = results
+
+	return nil
+}
+
+// search returns the issues of the query, requesting them page by page up to the configured limit. It reports whether
+// the issues were cut off by the limit.
+func (c *Connector) search(ctx context.Context, jiraClient client, jql string) ([]jiraApi.Issue, bool, error) {
+	limit := c.config.Limit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
+	options := &jiraApi.SearchOptions{Expand: "renderedFields", MaxResults: min(searchPageSize, limit)}
+	if c.config.Comments {
+		options.Fields = []string{"*navigable", "comment"}
+	}
+
+	var issues []jiraApi.Issue
+	var token string
+	for {
+		page, next, err := jiraClient.search(ctx, jql, options, token)
+		if err != nil {
+			return nil, false, err
+		}
+		issues = append(issues, page...)
+
+		if len(issues) > limit || (len(issues) == limit && next != "") {
+			log.Printf("%s: only the first %d issues of %q are synced", c.config.Name, limit, jql)
+			return issues[:limit], true, nil
+		}
+		if len(page) == 0 || next == "" {
+			return issues, false, nil
+		}
+
+		token = next
+	}
+}
+
+// createEntry formats an issue as task with the configured properties, and its description, subtasks and comments if
+// enabled. `field` is the key of the due date field.
+func (c *Connector) createEntry(i jiraApi.Issue, field string, properties []property) logseq.Entry {
+	var task logseq.Task
+	task.Id = i.Key
+	task.ConfigName = c.config.Name
+	// status and priority are missing if the fields are hidden or disabled; the status then gets the fallback marker
+	var status, priority string
+	if i.Fields.Status != nil {
+		status = i.Fields.Status.Name
+	}
+	if i.Fields.Priority != nil {
+		priority = i.Fields.Priority.Name
+	}
+	task.Status = c.config.Marker(status, statusMarkers)
+	task.Priority = c.config.Priority(priority, priorityNumbers)
+	task.Project = i.Fields.Project.Name
+	task.Url = c.config.Url + "browse/" + i.Key
+	task.Title = i.Fields.Summary
+
+	if dueDate, ok := i.Fields.Unknowns.Value(field); ok && field != "" {
+		task.DueDate, _ = dueDate.(string)
+	}
+
+	taskLine, uniqueStr := logseq.CreateTask(task)
+	block := logseq.ParseBlock(taskLine)
+	setProperties(block, i, properties)
+	if c.config.Description {
+		c.addDescription(block, i)
+	}
+	if c.config.Subtasks {
+		c.addSubtasks(block, i)
+	}
+	if c.config.Comments {
+		c.addComments(block, i)
+	}
+
+	return logseq.Entry{Content: block.String(), Id: c.idPrefix() + i.Key, UniqueStr: uniqueStr}
+}
 
-	for _, i := range issues {
-		var task logseq.Task
-		task.Id = i.Key
-		task.ConfigName = config.Name
-		task.Status = getTaskType(i.Fields.Status.Name)
-		task.Priority = getPrio(i.Fields.Priority.Name)
-		task.Project = i.Fields.Project.Name
-		task.Url = config.Url + "browse/" + i.Key
-		task.Title = i.Fields.Summary
+// Render returns the Jira page of every query, which is rebuilt from the fetched issues.
+// Child blocks and properties the user added to a task are kept.
+// Entries which are no longer returned are handled according to the stale setting of the instance, unless the issues of
+// the query were cut off by the limit.
+func (c *Connector) Render() []connector.Page {
+	var pages []connector.Page
+	for _, r := range c.results {
+		file := c.pageFile(r.query)
+		page := &logseq.TaskPage{Entries: r.entries, Owned: c.owned(), Stale: c.config.Stale, Partial: r.partial}
 
-		if dueDate, ok := i.Fields.Unknowns.Value(field); ok && dueDate != nil {
-			task.DueDate = dueDate.(string)
+		pages = append(pages, connector.Page{File: file + ".md", Items: len(r.entries), Update: page.Update})
+		if c.config.Stale.ArchivePage() {
+			pages = append(pages, connector.Page{File: file + "___archive.md", Update: page.UpdateArchive})
 		}
+	}
+
+	return pages
+}
 
-		taskLine, uniqueStr := logseq.CreateTask(task)
-		fileContent = logseq.AddOrReplaceEntry(uniqueStr, taskLine, fileContent)
+// Push creates the issues drafted in the graph and posts new comments, if enabled, and performs the Jira transition
+// for every synced issue whose marker was changed in Logseq since the last sync, if write-back is enabled. Issues
+// without a matching transition are logged and get their Jira status again.
+func (c *Connector) Push(ctx context.Context, graph fs.FS) ([]connector.Page, error) {
+	if !c.config.Create && !c.config.PostComments && !c.config.WriteBack {
+		return nil, nil
 	}
 
-	filename := path + config.Name + ".md"
+	jiraClient, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
 
-	fileHandle, handleErr := fileFunctions.GetFilehandle(filename)
-	if handleErr != nil {
-		log.Println(err)
+	var pages []connector.Page
+	if c.config.Create {
+		if pages, err = c.createIssues(ctx, jiraClient, graph); err != nil {
+			return pages, fmt.Errorf("failed to create issues: %w", err)
+		}
 	}
-	defer func(fileHandle *os.File) {
-		err := fileHandle.Close()
+
+	if c.config.PostComments {
+		posted, err := c.postComments(ctx, jiraClient, graph)
 		if err != nil {
-			log.Println(err)
+			return pages, fmt.Errorf("failed to post comments: %w", err)
 		}
-	}(fileHandle)
+		pages = append(pages, posted...)
+	}
+
+	if c.config.WriteBack {
+		if err := c.pushMarkers(ctx, jiraClient, graph); err != nil {
+			return pages, err
+		}
+	}
 
-	fileFunctions.WriteFile(fileContent, fileHandle)
+	return pages, nil
 }
 
-// getTaskType maps a given status string to a predefined task type and returns it. Defaults to "UNKNOWN" if no match is found.
-func getTaskType(status string) string {
-	statusToType := map[string]string{
-		"Open":                 "TODO",
-		"To Do":                "TODO",
-		"Pending":              "TODO",
-		"Reopened":             "TODO",
-		"Zu erledigen":         "TODO",
-		"In Arbeit":            "DOING",
-		"In Progress":          "DOING",
-		"Escalated":            "WAIT",
-		"Waiting for approval": "WAIT",
-		"Waiting for customer": "WAIT",
-		"Waiting for support":  "WAIT",
-		"Warten":               "WAIT",
-		"Canceled":             "CLOSED",
-		"Closed":               "CLOSED",
-		"Done":                 "DONE",
-		"Completed":            "DONE",
-		"Resolved":             "DONE",
+// pushMarkers performs the transitions for the marker changes on the Jira pages.
+func (c *Connector) pushMarkers(ctx context.Context, jiraClient client, graph fs.FS) error {
+	pages, err := c.readPages(graph)
+	if err != nil {
+		return err
 	}
 
-	if taskType, ok := statusToType[status]; ok {
-		return taskType
+	for _, page := range pages {
+		for _, change := range logseq.Changes(page) {
+			key, ok := strings.CutPrefix(change.Id, c.idPrefix())
+			if !ok {
+				continue
+			}
+
+			if err := c.transition(ctx, jiraClient, key, change.Marker); err != nil {
+				log.Printf("%s: failed to transition %s to %s: %v", c.config.Name, key, change.Marker, err)
+			}
+		}
 	}
-	return "UNKNOWN"
+
+	return nil
+}
+
+// transition moves the issue to the status of the Logseq marker. The transition is either configured for the marker
+// or the first available one leading to a status which is mapped to the marker.
+func (c *Connector) transition(ctx context.Context, jiraClient client, key string, marker string) error {
+	transitions, err := jiraClient.transitions(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	name, configured := c.transitionName(marker)
+	for _, t := range transitions {
+		to, known := c.config.Status(t.To.Name, statusMarkers)
+		if (configured && strings.EqualFold(t.Name, name)) || (!configured && known && taskType(to) == taskType(marker)) {
+			return jiraClient.doTransition(ctx, key, t.ID)
+		}
+	}
+
+	return errors.New("no transition available")
+}
+
+// transitionName returns the transition configured for the marker, matched case-insensitively.
+func (c *Connector) transitionName(marker string) (string, bool) {
+	for m, name := range c.config.Transitions {
+		if strings.EqualFold(m, marker) {
+			return name, true
+		}
+	}
+
+	return "", false
 }
 
-// getPrio maps a priority string to a corresponding integer value. Returns 0 for unrecognized priority strings.
-func getPrio(priority string) int {
-	switch priority {
-	case "Highest":
-		return 1
-	case "High":
-		return 1
-	case "Medium":
-		return 2
-	case "Low":
-		return 3
-	case "Lowest":
-		return 4
+// flavor returns the configured flavor, FlavorCloud if none is set. Flavors are matched case-insensitively.
+func (c *Connector) flavor() string {
+	if c.config.Flavor == "" {
+		return FlavorCloud
 	}
 
-	return 0
+	return strings.ToLower(c.config.Flavor)
+}
+
+// queries returns the configured queries. Without named queries, the instance has a single unnamed query.
+func (c *Connector) queries() []Query {
+	if len(c.config.Queries) > 0 {
+		return c.config.Queries
+	}
+
+	jql := c.config.Jql
+	if jql == "" {
+		jql = "assignee=\"" + c.config.Username + "\" AND status NOT IN (Done,Canceled,Closed,Completed)"
+	}
+
+	return []Query{{Jql: jql}}
+}
+
+// pageFile returns the path of the Jira page of the query, without extension.
+func (c *Connector) pageFile(query Query) string {
+	if query.Name == "" {
+		return "pages/jira___" + c.config.Name
+	}
+
+	return "pages/jira___" + c.config.Name + "___" + query.Name
+}
+
+// readPages parses the existing Jira pages of all queries, mapped by file without extension.
+func (c *Connector) readPages(graph fs.FS) (map[string]*logseq.Page, error) {
+	pages := make(map[string]*logseq.Page)
+	for _, query := range c.queries() {
+		file := c.pageFile(query)
+
+		content, err := fs.ReadFile(graph, file+".md")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		pages[file] = logseq.ParsePage(string(content))
+	}
+
+	return pages, nil
+}
+
+// idPrefix returns the prefix of the identity of all issues of the instance.
+func (c *Connector) idPrefix() string {
+	return "jira/" + c.config.Name + "/"
+}
+
+// taskType maps a Logseq marker to the marker of the same task type in statusMarkers, so e.g. NOW matches DOING.
+func taskType(marker string) string {
+	switch marker {
+	case "LATER":
+		return "TODO"
+	case "NOW", "IN-PROGRESS":
+		return "DOING"
+	case "WAITING":
+		return "WAIT"
+	case "CANCELLED":
+		return "CANCELED"
+	}
+
+	return marker
+}
+
+// statusMarkers are the built-in markers of Jira statuses.
+var statusMarkers = map[string]string{
+	"Open":                 "TODO",
+	"To Do":                "TODO",
+	"Pending":              "TODO",
+	"Reopened":             "TODO",
+	"Zu erledigen":         "TODO",
+	"In Arbeit":            "DOING",
+	"In Progress":          "DOING",
+	"Escalated":            "WAIT",
+	"Waiting for approval": "WAIT",
+	"Waiting for customer": "WAIT",
+	"Waiting for support":  "WAIT",
+	"Warten":               "WAIT",
+	"Canceled":             "CANCELED",
+	"Closed":               "DONE",
+	"Done":                 "DONE",
+	"Completed":            "DONE",
+	"Resolved":             "DONE",
+}
+
+// priorityNumbers are the built-in priority numbers of Jira priorities, see logseq.GetPrio.
+var priorityNumbers = map[string]int{
+	"Highest": 1,
+	"High":    1,
+	"Medium":  2,
+	"Low":     3,
+	"Lowest":  4,
 }
 
 // getFieldKey retrieves the key for a specific field name from a list of Jira fields. Returns an empty string if not found.
+// Names are matched case-insensitively; the key or ID of a field, e.g. "customfield_10016", is accepted as well.
 func getFieldKey(fieldName string, fields []jiraApi.Field) string {
 	for _, field := range fields {
-		if field.Name == fieldName {
+		if strings.EqualFold(field.Name, fieldName) || field.Key == fieldName || field.ID == fieldName {
+			if field.Key == "" {
+				// Jira Server only returns the ID
+				return field.ID
+			}
 			return field.Key
 		}
 	}
@@ -0,0 +1,43 @@
+package jira
+
+import (
+	jiraApi "github.com/andygrunwald/go-jira/v2/cloud"
+	"strings"
+	"testing"
+)
+
+func TestCreateEntryWithoutStatusAndPriority(t *testing.T) {
+	c := &Connector{config: Config{Name: "work", Url: "https://jira/"}}
+	issue := jiraApi.Issue{Key: "P-1", Fields: &jiraApi.IssueFields{Summary: "task"}}
+
+	entry := c.createEntry(issue, "", nil)
+
+	if want := "- TODO [#B] [[P-1]] [task](https://jira/browse/P-1)"; !strings.HasPrefix(entry.Content, want) {
+		t.Errorf("createEntry() = %q, want prefix %q", entry.Content, want)
+	}
+}
+
+func TestValidateFieldProperties(t *testing.T) {
+	tests := []struct {
+		prop  string
+		valid bool
+	}{
+		{"points", true},
+		{"story_points", true},
+		{"has space", false},
+		{"id", false},
+		{"Collapsed", false},
+		{"tags", false},
+		{"logseq-connector-id", false},
+		{"logseq-connector-marker", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prop, func(t *testing.T) {
+			c := &Connector{config: Config{Name: "work", Url: "https://jira/", Username: "u", Token: "t", Fields: map[string]string{"Field": tt.prop}}}
+			if err := c.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
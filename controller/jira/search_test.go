@@ -0,0 +1,122 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// issuesJSON returns the JSON of the issues with the keys P-from to P-(to-1).
+func issuesJSON(from int, to int) []map[string]interface{} {
+	var issues []map[string]interface{}
+	for i := from; i < to; i++ {
+		issues = append(issues, map[string]interface{}{"key": fmt.Sprintf("P-%d", i), "fields": map[string]interface{}{"summary": "s"}})
+	}
+
+	return issues
+}
+
+func TestSearchCloud(t *testing.T) {
+	const total = 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search/jql" {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("fields") != "*navigable" {
+			t.Errorf("fields = %q", r.URL.Query().Get("fields"))
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("nextPageToken"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		end := min(start+size, total)
+
+		result := map[string]interface{}{"issues": issuesJSON(start, end), "isLast": end == total}
+		if end < total {
+			result["nextPageToken"] = strconv.Itoa(end)
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		limit   int
+		want    int
+		partial bool
+	}{
+		{limit: 0, want: 5},
+		{limit: 5, want: 5},
+		{limit: 3, want: 3, partial: true},
+		{limit: 2, want: 2, partial: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.limit), func(t *testing.T) {
+			c := &Connector{config: Config{Name: "work", Url: server.URL + "/", Username: "u", Token: "t", Limit: tt.limit}}
+			jiraClient, err := c.getClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			issues, partial, err := c.search(context.Background(), jiraClient, "project = P")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(issues) != tt.want || partial != tt.partial {
+				t.Errorf("search() = %d issues, partial %v, want %d, %v", len(issues), partial, tt.want, tt.partial)
+			}
+			for i, issue := range issues {
+				if issue.Key != fmt.Sprintf("P-%d", i) {
+					t.Errorf("issue %d = %s", i, issue.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchServer(t *testing.T) {
+	const total = 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" {
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("maxResults"))
+		end := min(start+size, total)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"issues": issuesJSON(start, end), "startAt": start, "total": total})
+	}))
+	defer server.Close()
+
+	c := &Connector{config: Config{Name: "work", Url: server.URL + "/", Token: "t", Flavor: FlavorServer, Jql: "project = P"}}
+	jiraClient, err := c.getClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.config.Limit = 4
+	issues, partial, err := c.search(context.Background(), jiraClient, "project = P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 4 || !partial {
+		t.Errorf("search() = %d issues, partial %v, want 4, true", len(issues), partial)
+	}
+
+	c.config.Limit = 0
+	issues, partial, err = c.search(context.Background(), jiraClient, "project = P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != total || partial {
+		t.Errorf("search() = %d issues, partial %v, want %d, false", len(issues), partial, total)
+	}
+}
@@ -0,0 +1,314 @@
+package logseq
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// blankLines matches runs of empty lines, which are collapsed into one.
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// FromHTML converts HTML rendered by a source system, e.g. a Jira comment, into Logseq markdown lines.
+// List items are written with "•" bullets, as lines starting with "- " would be separate blocks in Logseq.
+func FromHTML(s string) []string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return strings.Split(s, "\n")
+	}
+
+	c := &htmlConverter{}
+	c.children(doc)
+
+	text := blankLines.ReplaceAllString(c.out.String(), "\n\n")
+	text = strings.Trim(text, "\n")
+	if text == "" {
+		return nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	return EscapeLines(lines)
+}
+
+// EscapeLines escapes the lines which would start a separate block in Logseq, "-" and "- ..." after any indentation,
+// and the lines which would be read as property, "key:: value", so they stay text of the block they are added to.
+// Lines inside code fences are left as they are, as they do not start blocks.
+func EscapeLines(lines []string) []string {
+	escaped := make([]string, len(lines))
+	var fence string
+	for i, line := range lines {
+		if fence == "" {
+			if match := blockStart.FindStringSubmatch(line); match != nil {
+				line = match[1] + `\` + line[len(match[1]):]
+			} else if key, _, ok := parseProperty(line); ok && strings.Contains(line, key+"::") {
+				line = strings.Replace(line, key+"::", key+`\::`, 1)
+			}
+		}
+		escaped[i] = line
+		fence = codeFence(strings.TrimSpace(line), fence)
+	}
+
+	return escaped
+}
+
+// htmlConverter writes the markdown of the visited nodes.
+type htmlConverter struct {
+	out strings.Builder
+	// lists are the next numbers of the open lists, 0 for unordered lists.
+	lists []int
+	pre   bool
+	// itemStart is the length of the output after the marker of the current list item.
+	itemStart int
+}
+
+// children converts all children of n.
+func (c *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.node(child)
+	}
+}
+
+// node converts n with its children.
+func (c *htmlConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head:
+	case atom.Br:
+		c.out.WriteString("\n")
+	case atom.Hr:
+		c.block()
+		c.out.WriteString("---")
+		c.block()
+	case atom.P, atom.Div, atom.Table:
+		c.block()
+		c.children(n)
+		c.block()
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.block()
+		c.wrap(n, "**")
+		c.block()
+	case atom.Strong, atom.B:
+		c.wrap(n, "**")
+	case atom.Em, atom.I:
+		c.wrap(n, "_")
+	case atom.Del, atom.S:
+		c.wrap(n, "~~")
+	case atom.Code, atom.Tt:
+		if c.pre {
+			c.children(n)
+		} else {
+			c.wrap(n, "`")
+		}
+	case atom.Pre:
+		c.block()
+		c.out.WriteString("```\n")
+		c.pre = true
+		c.children(n)
+		c.pre = false
+		c.out.WriteString("\n```")
+		c.block()
+	case atom.A:
+		c.link(n)
+	case atom.Img:
+		c.out.WriteString("![" + attr(n, "alt") + "](" + attr(n, "src") + ")")
+	case atom.Ul, atom.Ol:
+		marker := 0
+		if n.DataAtom == atom.Ol {
+			marker = 1
+		}
+		c.lists = append(c.lists, marker)
+		c.children(n)
+		c.lists = c.lists[:len(c.lists)-1]
+		if len(c.lists) > 0 {
+			c.line()
+		} else {
+			c.block()
+		}
+	case atom.Li:
+		c.listItem(n)
+	case atom.Blockquote:
+		c.quote(n)
+	case atom.Tr:
+		c.line()
+		c.out.WriteString("|")
+		c.children(n)
+		c.headerSeparator(n)
+	case atom.Th, atom.Td:
+		c.out.WriteString(" ")
+		c.children(n)
+		c.out.WriteString(" |")
+	default:
+		c.children(n)
+	}
+}
+
+// text writes a text node. Outside of code blocks whitespace is collapsed like a browser does.
+func (c *htmlConverter) text(s string) {
+	if c.pre {
+		c.out.WriteString(s)
+		return
+	}
+
+	collapsed := strings.Join(strings.Fields(s), " ")
+	if s != "" && isSpace(s[0]) && !c.afterSpace() {
+		c.out.WriteString(" ")
+	}
+	if collapsed == "" {
+		return
+	}
+
+	c.out.WriteString(collapsed)
+	if isSpace(s[len(s)-1]) {
+		c.out.WriteString(" ")
+	}
+}
+
+// wrap writes the children of n between the markup, e.g. "**".
+func (c *htmlConverter) wrap(n *html.Node, markup string) {
+	c.out.WriteString(markup)
+	c.children(n)
+	c.out.WriteString(markup)
+}
+
+// link writes a markdown link, or just the URL if it is also the text.
+func (c *htmlConverter) link(n *html.Node) {
+	href := attr(n, "href")
+	text := strings.TrimSpace(textContent(n))
+	switch {
+	case href == "" || strings.HasPrefix(href, "#"):
+		c.children(n)
+	case text == "" || text == href:
+		c.out.WriteString(href)
+	default:
+		c.out.WriteString("[" + text + "](" + href + ")")
+	}
+}
+
+// listItem writes a list item on its own line, indented by the depth of the list.
+func (c *htmlConverter) listItem(n *html.Node) {
+	c.line()
+	depth := len(c.lists)
+	if depth == 0 {
+		c.lists, depth = []int{0}, 1
+		defer func() { c.lists = nil }()
+	}
+
+	c.out.WriteString(strings.Repeat("  ", depth-1))
+	if marker := c.lists[depth-1]; marker > 0 {
+		c.out.WriteString(strconv.Itoa(marker) + ". ")
+		c.lists[depth-1]++
+	} else {
+		c.out.WriteString("• ")
+	}
+	c.itemStart = c.out.Len()
+	c.children(n)
+}
+
+// headerSeparator writes the separator line below a table row of header cells, so it is rendered as table header.
+func (c *htmlConverter) headerSeparator(row *html.Node) {
+	cells := 0
+	for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+		switch cell.DataAtom {
+		case atom.Th:
+			cells++
+		case atom.Td:
+			return
+		}
+	}
+
+	if cells > 0 {
+		c.out.WriteString("\n|" + strings.Repeat(" --- |", cells))
+	}
+}
+
+// quote writes the children of n with every line prefixed by "> ".
+func (c *htmlConverter) quote(n *html.Node) {
+	inner := &htmlConverter{lists: c.lists}
+	inner.children(n)
+
+	c.block()
+	text := blankLines.ReplaceAllString(inner.out.String(), "\n\n")
+	for i, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+		if i > 0 {
+			c.out.WriteString("\n")
+		}
+		c.out.WriteString(strings.TrimRight("> "+line, " "))
+	}
+	c.block()
+}
+
+// block ends the current paragraph with an empty line. Inside a list item it only starts a new line, and right after
+// the marker of the item nothing, so the text of the item stays next to its marker.
+func (c *htmlConverter) block() {
+	switch {
+	case c.out.Len() == 0 || c.out.Len() == c.itemStart:
+	case len(c.lists) > 0:
+		c.line()
+	default:
+		c.out.WriteString("\n\n")
+	}
+}
+
+// line starts a new line unless the output is already at the start of one.
+func (c *htmlConverter) line() {
+	if !c.atLineStart() {
+		c.out.WriteString("\n")
+	}
+}
+
+// atLineStart reports whether the next text starts a new line.
+func (c *htmlConverter) atLineStart() bool {
+	s := c.out.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// afterSpace reports whether the next text follows whitespace, so a leading space of it is dropped.
+func (c *htmlConverter) afterSpace() bool {
+	s := c.out.String()
+	return s == "" || isSpace(s[len(s)-1])
+}
+
+// attr returns the value of the attribute key of n.
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+// textContent returns the text of n and all its descendants.
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		sb.WriteString(textContent(child))
+	}
+
+	return sb.String()
+}
+
+// isSpace reports whether b is HTML whitespace.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
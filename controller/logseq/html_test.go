@@ -0,0 +1,46 @@
+package logseq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFromHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"paragraphs", "<p>one</p><p>two <b>bold</b> <i>it</i></p>", []string{"one", "", "two **bold** _it_"}},
+		{"whitespace", "<p>  a \n  b  </p>", []string{"a b"}},
+		{"line break", "a<br>b", []string{"a", "b"}},
+		{"link", `<a href="https://x.y">text</a> <a href="https://x.y">https://x.y</a>`, []string{"[text](https://x.y) https://x.y"}},
+		{"unordered list", "<ul><li>one</li><li>two</li></ul>", []string{"• one", "• two"}},
+		{"ordered list", "<ol><li>one</li><li>two</li></ol>", []string{"1. one", "2. two"}},
+		{"nested list", "<ul><li>one<ul><li>inner</li></ul></li><li>two</li></ul>", []string{"• one", "  • inner", "• two"}},
+		{"paragraphs in list items", "<ul><li><p>one</p></li><li><p>two</p><p>more</p></li></ul><p>after</p>", []string{"• one", "• two", "more", "", "after"}},
+		{"dash lines", "<p>- not a block</p><p>-</p>", []string{`\- not a block`, "", `\-`}},
+		{"code block", "<pre>- removed\n+ added</pre><p>- text</p>", []string{"```", "- removed", "+ added", "```", "", `\- text`}},
+		{"inline code", "<p>use <code>go test</code></p>", []string{"use `go test`"}},
+		{"quote", "<blockquote><p>one</p><p>two</p></blockquote>", []string{"> one", ">", "> two"}},
+		{"table", "<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>", []string{"| a | b |", "| --- | --- |", "| 1 | 2 |"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromHTML(tt.html); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromHTML(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeLines(t *testing.T) {
+	lines := []string{"- a", "-", "-b", "  - c", "\t- d", "key:: value", "a:: b:: c", "```", "- code", "key:: value", "```", "~~~", "- code", "- ```", "~~~", "- b"}
+	want := []string{`\- a`, `\-`, "-b", `  \- c`, "\t\\- d", `key\:: value`, `a\:: b:: c`, "```", "- code", "key:: value", "```", "~~~", "- code", "- ```", "~~~", `\- b`}
+
+	if got := EscapeLines(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("EscapeLines() = %q, want %q", got, want)
+	}
+}
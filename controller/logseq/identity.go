@@ -0,0 +1,61 @@
+package logseq
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+)
+
+// IdProperty is the property holding the connector-scoped identity of a synced block, e.g. "jira/work/PROJ-123".
+const IdProperty = "logseq-connector-id"
+
+// uuidNamespace is the RFC 4122 URL namespace the block UUIDs are derived in.
+var uuidNamespace = [16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// BlockUUID returns the deterministic block UUID (version 5) of the synced item `id`.
+// The same item therefore gets the same `id::` on every sync and in every graph.
+func BlockUUID(id string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write([]byte("logseq-connector://" + id))
+	u := h.Sum(nil)[:16]
+
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// NewBlockUUID returns a random block UUID (version 4), as Logseq creates it for a block.
+func NewBlockUUID() string {
+	u := make([]byte, 16)
+	_, _ = rand.Read(u)
+
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// SetIdentity marks `block` as the synced item `id`. Unless the block already has a Logseq block UUID,
+// it gets the deterministic one, so the item can be referenced with ((uuid)) from elsewhere in the graph.
+func SetIdentity(block *Block, id string) {
+	block.SetProperty(IdProperty, id)
+
+	if _, ok := block.Property("id"); !ok {
+		block.SetProperty("id", BlockUUID(id))
+	}
+}
+
+// Identity returns the connector-scoped identity of a synced block, or an empty string.
+func Identity(block *Block) string {
+	id, _ := block.Property(IdProperty)
+	return id
+}
+
+// FindById returns the block of the synced item `id`, wherever it is nested in the page, or nil.
+func FindById(page *Page, id string) *Block {
+	return page.Find(func(b *Block) bool {
+		return Identity(b) == id
+	})
+}
@@ -3,10 +3,30 @@ package logseq
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
 
+// TaskProperties are the properties rendered by CreateTask. All other properties of a task entry belong to the user.
+var TaskProperties = []string{"Project", "tags", "SCHEDULED"}
+
+// reservedProperties are the built-in properties of Logseq, which change how a block or page behaves, see
+// IsReservedProperty.
+var reservedProperties = []string{"id", "collapsed", "title", "alias", "tags", "template", "template-including-parent",
+	"public", "filters", "icon", "heading", "background-color", "exclude-from-graph-view", "created-at", "updated-at",
+	"query-table", "query-properties", "query-sort-by", "query-sort-desc", "ls-type", "hl-type", "hl-page", "hl-stamp",
+	"hl-color", "card-last-interval", "card-repeats", "card-last-reviewed", "card-next-schedule", "card-ease-factor",
+	"card-last-score"}
+
+// IsReservedProperty reports whether a connector must not render a value of the source system, e.g. a Jira field, as
+// the property: properties with a meaning in Logseq, the TaskProperties and the ones the connector tracks its state
+// with, e.g. IdProperty.
+func IsReservedProperty(name string) bool {
+	return isOwned(name, reservedProperties) || isOwned(name, TaskProperties) ||
+		strings.HasPrefix(strings.ToLower(name), "logseq-connector-")
+}
+
 type Task struct {
 	Id         string
 	ConfigName string
@@ -17,70 +37,327 @@ type Task struct {
 	Url        string
 	Tags       []string
 	DueDate    string
+	// Deadline renders the due date as DEADLINE instead of SCHEDULED.
+	Deadline bool
+}
+
+// Entry is a rendered entry of a page together with its identity.
+type Entry struct {
+	Content string
+	// Id is the connector-scoped identity of the entry, see IdProperty.
+	Id string
+	// UniqueStr identifies entries written before they carried an identity, by their first line.
+	UniqueStr string
+}
+
+// FindEntry returns the top-level block of `entry` in the page. Blocks are matched by their identity; the first line
+// is only searched for the UniqueStr of the entry in blocks without any identity, as written by older versions.
+// As the unique string is rendered at the start of an entry, the block containing it first wins, so a task mentioning
+// another one in its title is not mistaken for it.
+func FindEntry(page *Page, entry Entry) *Block {
+	for _, b := range page.Blocks {
+		if Identity(b) == entry.Id {
+			return b
+		}
+	}
+
+	if entry.UniqueStr == "" {
+		return nil
+	}
+
+	var found *Block
+	position := -1
+	for _, b := range page.Blocks {
+		if Identity(b) != "" {
+			continue
+		}
+
+		if i := strings.Index(b.Content(), entry.UniqueStr); i >= 0 && (position < 0 || i < position) {
+			found, position = b, i
+		}
+	}
+
+	return found
 }
 
-// AddOrReplaceEntry searches for an entry starting with "- ", containing `searchStr`,
-// replaces it entirely with `insertStr`, or prepends `insertStr` to the file content if `searchStr` is not found.
-// An entry starts with "- " and ends either at the beginning of the next entry or the end of the file.
-func AddOrReplaceEntry(searchStr string, insertStr string, fileContent string) string {
-	lines := strings.Split(fileContent, "\n")
-	var newContent []string
-	var found bool
+// RenderedProperty lists the properties rendered on a block in addition to the owned ones, e.g. one per scoped label,
+// so they are removed by MergeBlock once they are no longer rendered. See SetRenderedProperty.
+const RenderedProperty = "logseq-connector-properties"
 
-	i := 0
-	for i < len(lines) {
-		line := lines[i]
+// SetRenderedProperty sets the property of the block and records it in RenderedProperty.
+func SetRenderedProperty(block *Block, key string, value string) {
+	block.SetProperty(key, value)
 
-		// An entry starts with "- "
-		if strings.HasPrefix(line, "- ") {
-			start := i // Mark the start of the current entry
+	names := renderedProperties(block)
+	if !isOwned(key, names) {
+		block.SetProperty(RenderedProperty, strings.Join(append(names, key), ", "))
+	}
+}
+
+// renderedProperties returns the properties recorded in RenderedProperty of the block.
+func renderedProperties(block *Block) []string {
+	value, _ := block.Property(RenderedProperty)
+
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
 
-			// Find the end of the current entry
-			j := i + 1
-			for j < len(lines) && !strings.HasPrefix(lines[j], "- ") {
-				j++
+	return names
+}
+
+// MergeBlock combines a freshly rendered block with the existing one. The first line and the properties listed in
+// `owned` or recorded in RenderedProperty are taken from `rendered`, all other properties, content lines and child
+// blocks of `existing` are kept.
+// The identity is taken from `existing` as well, so block references to it stay valid.
+// Child blocks whose identity is scoped below the one of the block, e.g. the comments of an issue, are rendered by the
+// connector: they are replaced by the rendered children, which are merged the same way, and keep their collapsed state.
+func MergeBlock(existing *Block, rendered *Block, owned []string) *Block {
+	merged := &Block{Indent: rendered.Indent, lines: append([]string{}, rendered.lines...)}
+	merged.SetIndent(existing.Indent)
+
+	owned = append(append([]string{RenderedProperty}, renderedProperties(existing)...), owned...)
+	var kept []string
+	for _, line := range existing.propertyLines() {
+		if key, _, ok := parseProperty(line); ok && !isOwned(key, owned) && !hasProperty(rendered, key) {
+			kept = append(kept, line)
+		}
+	}
+
+	end := 1 + len(merged.propertyLines())
+	lines := append(append([]string{}, merged.lines[:end]...), kept...)
+	lines = append(lines, merged.lines[end:]...)
+	merged.lines = append(lines, existing.lines[1+len(existing.propertyLines()):]...)
+
+	merged.Children = mergeChildren(existing, rendered)
+
+	return merged
+}
+
+// mergeChildren returns the rendered children followed by the children the user added to `existing`.
+func mergeChildren(existing *Block, rendered *Block) []*Block {
+	var scope string
+	if id := Identity(existing); id != "" {
+		scope = id + "/"
+	}
+
+	children := append([]*Block{}, rendered.Children...)
+	for _, child := range existing.Children {
+		id := Identity(child)
+		if scope == "" || !strings.HasPrefix(id, scope) {
+			children = append(children, child)
+			continue
+		}
+
+		for _, r := range rendered.Children {
+			if Identity(r) != id {
+				continue
 			}
 
-			// Combine all lines of the current entry
-			entryBlock := strings.Join(lines[start:j], "\n")
+			grandchildren := mergeChildren(child, r)
+			r.Children = nil
+			for _, grandchild := range grandchildren {
+				r.AddChild(grandchild)
+			}
 
-			// Check if the current entry contains `searchStr`
-			if strings.Contains(entryBlock, searchStr) {
-				// Replace the current entry with `insertStr`
-				newContent = append(newContent, insertStr)
-				found = true
+			if collapsed, ok := child.Property("collapsed"); ok {
+				r.SetProperty("collapsed", collapsed)
 			} else {
-				// If it doesn't match, retain the current entry
-				newContent = append(newContent, lines[start:j]...)
+				r.RemoveProperty("collapsed")
 			}
+		}
+	}
+
+	return children
+}
+
+// TaskPage rebuilds a page of synced entries, keeping the page properties and the user content of entries already
+// present. The properties listed in Owned are rendered by the connector and replaced on every sync. Every entry gets its
+// identity and the marker it was synced with, new entries are added in front of the previous ones. Entries which are no
+// longer returned by the source system are handled according to Stale, unless they are still pending, see
+// PendingProperty.
+type TaskPage struct {
+	Entries []Entry
+	Owned   []string
+	Stale   StaleConfig
+	// Properties are page properties rendered by the connector, e.g. an alias. They are set on every sync, all other
+	// page properties are kept.
+	Properties map[string]string
+	// Partial marks Entries as incomplete, e.g. cut off by a limit. Entries missing from them are kept unchanged
+	// instead of being handled according to Stale.
+	Partial bool
+
+	// archived are the entries Update moved away, which UpdateArchive adds to the archive page.
+	archived []*Block
+}
+
+// Update returns the rebuilt content of the page `fileContent`.
+func (t *TaskPage) Update(fileContent string) string {
+	old := ParsePage(fileContent)
+	page := &Page{Preamble: old.Preamble, trailingNewline: old.trailingNewline}
 
-			// Skip the processed lines of the current entry
-			i = j
+	keys := make([]string, 0, len(t.Properties))
+	for key := range t.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		page.SetProperty(key, t.Properties[key])
+	}
+
+	var archive *Block
+	for _, b := range old.Blocks {
+		if isArchive(b) {
+			archive = b
+			break
+		}
+	}
+
+	found := make(map[*Block]bool)
+	for _, entry := range t.Entries {
+		block := ParseBlock(entry.Content)
+		if block == nil {
+			continue
+		}
+
+		existing := FindEntry(old, entry)
+		if existing == nil && archive != nil {
+			// an archived entry which is returned again moves back to the page
+			if existing = findBlock(archive.Children, func(b *Block) bool { return Identity(b) == entry.Id }); existing != nil {
+				removeBlock(&archive.Children, existing)
+				existing.SetIndent("")
+			}
+		}
+		if existing != nil {
+			found[existing] = true
+			block = MergeBlock(existing, block, t.Owned)
+			block.RemoveProperty(MissingSinceProperty)
+			block.RemoveProperty(PendingProperty)
+		}
+		SetIdentity(block, entry.Id)
+		setSyncedMarker(block)
+
+		if previous := FindEntry(page, Entry{Id: entry.Id}); previous != nil {
+			*previous = *block
 		} else {
-			// If the line does not belong to an entry, add it as is
-			newContent = append(newContent, line)
-			i++
+			page.Blocks = append([]*Block{block}, page.Blocks...)
+		}
+	}
+
+	now := time.Now()
+	for _, b := range old.Blocks {
+		if found[b] || b == archive || Identity(b) == "" {
+			continue
+		}
+		if t.Partial || hasProperty(b, PendingProperty) {
+			page.Blocks = append(page.Blocks, b)
+			continue
+		}
+
+		since, err := time.Parse(time.RFC3339, propertyValue(b, MissingSinceProperty))
+		if err != nil {
+			since = now
+			b.SetProperty(MissingSinceProperty, now.Format(time.RFC3339))
+		}
+		if now.Sub(since) < t.Stale.grace() {
+			page.Blocks = append(page.Blocks, b)
+			continue
+		}
+
+		switch t.Stale.action() {
+		case StaleDone:
+			b.SetMarker("DONE")
+			page.Blocks = append(page.Blocks, b)
+		case StaleCanceled:
+			b.SetMarker("CANCELED")
+			page.Blocks = append(page.Blocks, b)
+		case StaleArchive:
+			if archive == nil {
+				archive = newArchive()
+			}
+			archive.AddChild(b)
+		case StaleArchivePage:
+			t.archived = append(t.archived, b)
+		}
+	}
+
+	if archive != nil {
+		page.Blocks = append(page.Blocks, archive)
+	}
+
+	return page.String()
+}
+
+// UpdateArchive returns the content of the archive page `fileContent` with the entries archived by Update added.
+// Entries which are returned by the source system again are removed from it, as Update puts them back on the page.
+// It has to be called after Update.
+func (t *TaskPage) UpdateArchive(fileContent string) string {
+	page := ParsePage(fileContent)
+	if fileContent == "" && len(t.archived) > 0 {
+		page.trailingNewline = true
+	}
+
+	for _, entry := range t.Entries {
+		if b := FindById(page, entry.Id); b != nil {
+			page.Remove(b)
+		}
+	}
+	for _, b := range t.archived {
+		if previous := FindById(page, Identity(b)); previous != nil {
+			page.Remove(previous)
 		}
+		page.Append(b)
 	}
 
-	// If no matching entry was found, prepend `insertStr` to the content
-	if !found {
-		newContent = append([]string{insertStr}, newContent...)
+	return page.String()
+}
+
+// propertyValue returns the value of the block property `key`, or an empty string.
+func propertyValue(b *Block, key string) string {
+	value, _ := b.Property(key)
+	return value
+}
+
+// hasProperty reports whether the block already has the property `key`.
+func hasProperty(b *Block, key string) bool {
+	_, ok := b.Property(key)
+	return ok
+}
+
+// isOwned reports whether the property `key` is in the list of properties owned by the connector.
+func isOwned(key string, owned []string) bool {
+	for _, o := range owned {
+		if strings.EqualFold(key, o) {
+			return true
+		}
 	}
 
-	return strings.Join(newContent, "\n")
+	return false
 }
 
 // GetScheduledDateFormat formats a given date string into the format "SCHEDULED: <YYYY-MM-DD DDD>".
 // Returns an empty string if the input date cannot be parsed.
 func GetScheduledDateFormat(date string) string {
+	return getDateFormat("SCHEDULED", date)
+}
+
+// GetDeadlineDateFormat formats a given date string into the format "DEADLINE: <YYYY-MM-DD DDD>".
+// Returns an empty string if the input date cannot be parsed.
+func GetDeadlineDateFormat(date string) string {
+	return getDateFormat("DEADLINE", date)
+}
+
+// getDateFormat formats a given date string as Logseq date line with the keyword, SCHEDULED or DEADLINE.
+func getDateFormat(keyword string, date string) string {
 	parsedDate, err := time.Parse("2006-01-02", date)
 	if err != nil {
 		log.Println("Error parsing date:", err)
 		return ""
 	}
 
-	return fmt.Sprintf("SCHEDULED: <%s %s>", parsedDate.Format("2006-01-02"), parsedDate.Weekday().String()[:3])
+	return fmt.Sprintf("%s: <%s %s>", keyword, parsedDate.Format("2006-01-02"), parsedDate.Weekday().String()[:3])
 }
 
 // GetPrio returns a string representation of a priority based on the provided integer value.
@@ -125,6 +402,9 @@ func CreateTask(task Task) (string, string) {
 
 	if task.DueDate != "" {
 		dueDate := GetScheduledDateFormat(task.DueDate)
+		if task.Deadline {
+			dueDate = GetDeadlineDateFormat(task.DueDate)
+		}
 		if dueDate != "" {
 			result += "\n  " + dueDate
 		}
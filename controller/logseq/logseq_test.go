@@ -0,0 +1,256 @@
+package logseq
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeBlock(t *testing.T) {
+	existing := ParseBlock("- TODO old title\n  tags:: old\n  note:: mine\n  logseq-connector-id:: x/1\n  id:: 1234\n  user text\n  - user child")
+	rendered := ParseBlock("- DONE new title\n  tags:: new\n  completed:: today")
+
+	merged := MergeBlock(existing, rendered, []string{"tags", "completed"})
+
+	want := "- DONE new title\n  tags:: new\n  completed:: today\n  note:: mine\n  logseq-connector-id:: x/1\n  id:: 1234\n  user text\n  - user child"
+	if got := merged.String(); got != want {
+		t.Errorf("MergeBlock() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMergeBlockOwnedPropertyRemoved(t *testing.T) {
+	existing := ParseBlock("- TODO a\n  tags:: old\n  SCHEDULED: <2024-01-02 Tue>")
+	rendered := ParseBlock("- TODO a")
+
+	merged := MergeBlock(existing, rendered, TaskProperties)
+
+	if got := merged.String(); got != "- TODO a" {
+		t.Errorf("MergeBlock() = %q", got)
+	}
+}
+
+func TestTaskPageUpdateRenderedProperties(t *testing.T) {
+	labels := map[string]string{"severity": "critical", "team": "core"}
+	render := func(keys ...string) *TaskPage {
+		block := ParseBlock("- TODO a")
+		for _, key := range keys {
+			SetRenderedProperty(block, key, labels[key])
+		}
+		return &TaskPage{Entries: []Entry{{Content: block.String(), Id: "t/1"}}, Owned: TaskProperties}
+	}
+
+	first := render("severity", "team").Update("")
+	edited := strings.Replace(first, "  team:: core\n", "  team:: core\n  mine:: kept\n", 1)
+
+	got := withoutStateProperties(render("team").Update(edited))
+	want := "- TODO a\n  team:: core\n  " + RenderedProperty + ":: team\n  mine:: kept\n  id:: " + BlockUUID("t/1") + "\n"
+	if got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+
+	got = withoutStateProperties(render().Update(edited))
+	if want := "- TODO a\n  mine:: kept\n  id:: " + BlockUUID("t/1") + "\n"; got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMergeBlockScopedChildren(t *testing.T) {
+	existing := ParseBlock(strings.Join([]string{
+		"- TODO a",
+		"  logseq-connector-id:: x/1",
+		"  - **Description**",
+		"    logseq-connector-id:: x/1/description",
+		"    - old text",
+		"      logseq-connector-id:: x/1/description/text",
+		"    - note below the description",
+		"  - user child",
+	}, "\n"))
+	rendered := ParseBlock(strings.Join([]string{
+		"- TODO a",
+		"  logseq-connector-id:: x/1",
+		"  - **Description**",
+		"    collapsed:: true",
+		"    logseq-connector-id:: x/1/description",
+		"    - new text",
+		"      logseq-connector-id:: x/1/description/text",
+	}, "\n"))
+
+	merged := MergeBlock(existing, rendered, nil)
+
+	want := strings.Join([]string{
+		"- TODO a",
+		"  logseq-connector-id:: x/1",
+		"  - **Description**",
+		"    logseq-connector-id:: x/1/description",
+		"    - new text",
+		"      logseq-connector-id:: x/1/description/text",
+		"    - note below the description",
+		"  - user child",
+	}, "\n")
+	if got := merged.String(); got != want {
+		t.Errorf("MergeBlock() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTaskPageUpdate(t *testing.T) {
+	page := &TaskPage{
+		Entries: []Entry{
+			{Content: "- TODO [[A-1]] first\n  tags:: x", Id: "t/A-1"},
+			{Content: "- DONE [[A-2]] second", Id: "t/A-2"},
+		},
+		Owned: TaskProperties,
+	}
+
+	first := page.Update("title:: Tasks\n")
+	want := strings.Join([]string{
+		"title:: Tasks",
+		"- DONE [[A-2]] second",
+		"  logseq-connector-id:: t/A-2",
+		"  id:: " + BlockUUID("t/A-2"),
+		"  logseq-connector-marker:: DONE",
+		"- TODO [[A-1]] first",
+		"  tags:: x",
+		"  logseq-connector-id:: t/A-1",
+		"  id:: " + BlockUUID("t/A-1"),
+		"  logseq-connector-marker:: TODO",
+		"",
+	}, "\n")
+	if first != want {
+		t.Fatalf("Update() =\n%s\nwant\n%s", first, want)
+	}
+
+	if second := page.Update(first); second != first {
+		t.Errorf("second Update() =\n%s\nwant unchanged\n%s", second, first)
+	}
+
+	edited := strings.Replace(first, "  logseq-connector-marker:: TODO\n", "  logseq-connector-marker:: TODO\n  mine:: kept\n  - my note\n", 1)
+	if got := page.Update(edited); got != edited {
+		t.Errorf("Update() dropped user content:\n%s\nwant\n%s", got, edited)
+	}
+}
+
+func TestTaskPageUpdateLegacyEntry(t *testing.T) {
+	page := &TaskPage{Entries: []Entry{{Content: "- TODO Proj [#1](url) new title", Id: "g/1#1", UniqueStr: "Proj [#1]"}}}
+
+	got := page.Update("- TODO Proj [#1](url) old title\n  mine:: kept\n")
+
+	want := strings.Join([]string{
+		"- TODO Proj [#1](url) new title",
+		"  mine:: kept",
+		"  logseq-connector-id:: g/1#1",
+		"  id:: " + BlockUUID("g/1#1"),
+		"  logseq-connector-marker:: TODO",
+		"",
+	}, "\n")
+	if got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTaskPageUpdateStale(t *testing.T) {
+	old := "- TODO gone\n  logseq-connector-id:: t/1\n  logseq-connector-marker:: TODO\n"
+
+	tests := []struct {
+		name  string
+		stale StaleConfig
+		want  string
+	}{
+		{"delete", StaleConfig{}, "\n"},
+		{"done", StaleConfig{Action: StaleDone}, "- DONE gone\n"},
+		{"canceled", StaleConfig{Action: "Canceled"}, "- CANCELED gone\n"},
+		{"archive", StaleConfig{Action: StaleArchive}, "- Archive\n  logseq-connector-archive:: true\n  collapsed:: true\n  - TODO gone\n"},
+		{"grace", StaleConfig{Grace: "24h"}, "- TODO gone\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &TaskPage{Stale: tt.stale}
+			got := withoutStateProperties(page.Update(old))
+			if got != tt.want {
+				t.Errorf("Update() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskPageUpdatePartial(t *testing.T) {
+	old := "- TODO kept\n  logseq-connector-id:: t/1\n  logseq-connector-marker:: TODO\n"
+
+	page := &TaskPage{Entries: []Entry{{Content: "- TODO new", Id: "t/2"}}, Partial: true}
+	got := withoutStateProperties(page.Update(old))
+	if want := "- TODO new\n  id:: " + BlockUUID("t/2") + "\n- TODO kept\n"; got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTaskPageUpdateGraceExpired(t *testing.T) {
+	since := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	old := "- TODO gone\n  logseq-connector-id:: t/1\n  " + MissingSinceProperty + ":: " + since + "\n"
+
+	page := &TaskPage{Stale: StaleConfig{Grace: "24h"}}
+	if got := page.Update(old); got != "\n" {
+		t.Errorf("Update() = %q, want the entry deleted", got)
+	}
+}
+
+func TestTaskPageArchivePage(t *testing.T) {
+	page := &TaskPage{Stale: StaleConfig{Action: StaleArchivePage}}
+
+	if got := page.Update("- TODO gone\n  logseq-connector-id:: t/1\n"); got != "\n" {
+		t.Errorf("Update() = %q, want the entry moved away", got)
+	}
+	if got := withoutStateProperties(page.UpdateArchive("")); got != "- TODO gone\n" {
+		t.Errorf("UpdateArchive() = %q", got)
+	}
+}
+
+// withoutStateProperties removes the properties tracking the sync state, which depend on identity and time.
+func withoutStateProperties(content string) string {
+	var lines []string
+	for _, line := range strings.SplitAfter(content, "\n") {
+		key, _, ok := parseProperty(strings.TrimSuffix(line, "\n"))
+		if ok && (key == IdProperty || key == MarkerProperty || key == MissingSinceProperty) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "")
+}
+
+func TestTaskPageUpdatePending(t *testing.T) {
+	old := "- TODO created\n  logseq-connector-id:: t/1\n  id:: 1234\n  " + PendingProperty + ":: true\n"
+
+	page := &TaskPage{}
+	if got := page.Update(old); got != old {
+		t.Errorf("Update() =\n%s\nwant the pending entry kept\n%s", got, old)
+	}
+
+	page = &TaskPage{Entries: []Entry{{Content: "- TODO created", Id: "t/1"}}}
+	want := "- TODO created\n  logseq-connector-id:: t/1\n  id:: 1234\n  logseq-connector-marker:: TODO\n"
+	if got := page.Update(old); got != want {
+		t.Errorf("Update() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestIsReservedProperty(t *testing.T) {
+	tests := map[string]bool{
+		"severity":            false,
+		"team":                false,
+		"id":                  true,
+		"collapsed":           true,
+		"template":            true,
+		"Alias":               true,
+		"public":              true,
+		"tags":                true,
+		"project":             true,
+		"logseq-connector-id": true,
+		"logseq-connector-x":  true,
+	}
+
+	for name, want := range tests {
+		if got := IsReservedProperty(name); got != want {
+			t.Errorf("IsReservedProperty(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package logseq
+
+import (
+	"errors"
+	"strings"
+)
+
+// defaultFallbackMarker is the marker of statuses which are neither configured nor known to the connector.
+const defaultFallbackMarker = "TODO"
+
+// priorities are the Logseq priorities in the order of the numbers GetPrio renders.
+var priorities = []string{"A", "B", "C", "D"}
+
+// Mapping maps the statuses and priorities of a source system to Logseq markers and priorities. The configured
+// tables override or extend the built-in ones of the connector.
+type Mapping struct {
+	// StatusMap maps a status of the source system to a Logseq marker, e.g. "In Review": "DOING".
+	StatusMap map[string]string
+	// PriorityMap maps a priority of the source system to a Logseq priority from "A" to "D".
+	PriorityMap map[string]string
+	// FallbackMarker is the marker of statuses which are in neither table, defaultFallbackMarker if not set.
+	FallbackMarker string
+}
+
+// Validate checks that all configured markers and priorities are valid in Logseq.
+func (m Mapping) Validate() error {
+	for status, marker := range m.StatusMap {
+		if !IsMarker(marker) {
+			return errors.New("statusMap: " + marker + " of " + status + " is not a Logseq marker")
+		}
+	}
+	for priority, value := range m.PriorityMap {
+		if PriorityNumber(value) == 0 {
+			return errors.New("priorityMap: " + value + " of " + priority + " must be one of A, B, C, D")
+		}
+	}
+	if m.FallbackMarker != "" && !IsMarker(m.FallbackMarker) {
+		return errors.New("fallbackMarker: " + m.FallbackMarker + " is not a Logseq marker")
+	}
+
+	return nil
+}
+
+// Marker returns the marker of a status: the configured one, the built-in one or the fallback marker.
+// Statuses are matched case-insensitively.
+func (m Mapping) Marker(status string, builtin map[string]string) string {
+	if marker, ok := m.Status(status, builtin); ok {
+		return marker
+	}
+	if m.FallbackMarker != "" {
+		return strings.ToUpper(m.FallbackMarker)
+	}
+
+	return defaultFallbackMarker
+}
+
+// Status returns the configured or built-in marker of a status. It reports false for unknown statuses, which Marker
+// maps to the fallback marker.
+func (m Mapping) Status(status string, builtin map[string]string) (string, bool) {
+	if marker, ok := lookup(m.StatusMap, status); ok {
+		return strings.ToUpper(marker), true
+	}
+
+	return lookup(builtin, status)
+}
+
+// Priority returns the priority number of a priority of the source system, see GetPrio: the configured one or the
+// built-in one. It returns 0 for unknown priorities.
+func (m Mapping) Priority(priority string, builtin map[string]int) int {
+	if value, ok := lookup(m.PriorityMap, priority); ok {
+		return PriorityNumber(value)
+	}
+
+	number, _ := lookup(builtin, priority)
+	return number
+}
+
+// lookup returns the value of key in table. An exact match wins over one which only differs in case.
+func lookup[V any](table map[string]V, key string) (V, bool) {
+	if value, ok := table[key]; ok {
+		return value, true
+	}
+	for k, value := range table {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+
+	var zero V
+	return zero, false
+}
+
+// PriorityNumber returns the number of a Logseq priority written as "A" or "[#A]", or 0 if it is none.
+func PriorityNumber(value string) int {
+	value = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "[#"), "]")
+	for i, p := range priorities {
+		if strings.EqualFold(value, p) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// IsMarker reports whether marker is one of the Markers, ignoring case.
+func IsMarker(marker string) bool {
+	for _, m := range Markers {
+		if strings.EqualFold(marker, m) {
+			return true
+		}
+	}
+
+	return false
+}
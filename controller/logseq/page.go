@@ -0,0 +1,409 @@
+package logseq
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markers are the task markers Logseq recognizes at the start of a block.
+var Markers = []string{"TODO", "DOING", "NOW", "LATER", "WAIT", "WAITING", "IN-PROGRESS", "DONE", "CANCELED", "CANCELLED"}
+
+// blockStart matches the first line of a block and captures its indentation.
+var blockStart = regexp.MustCompile(`^([ \t]*)-(?: |\r?$)`)
+
+// propertyLine matches a property line and captures key and value. SCHEDULED and DEADLINE lines count as properties.
+var propertyLine = regexp.MustCompile(`^[ \t]*(?:([\w-]+)::(?:[ \t]+(.*?))?|(SCHEDULED|DEADLINE): (<.*>))[ \t]*\r?$`)
+
+// Page is a Logseq markdown page parsed into a tree of blocks.
+// Serializing an unchanged page with String returns exactly the parsed content.
+type Page struct {
+	// Preamble are the raw lines before the first block, usually the page properties.
+	Preamble []string
+	// Blocks are the top-level blocks of the page.
+	Blocks []*Block
+
+	trailingNewline bool
+}
+
+// Block is a single block of a page. It keeps its raw lines, so unknown content survives a round trip unchanged.
+type Block struct {
+	// Indent is the whitespace in front of the "- " of the first line.
+	Indent string
+	// Children are the nested blocks.
+	Children []*Block
+
+	// lines are the raw lines of the block itself, without its children. The first line starts with Indent + "-".
+	lines []string
+}
+
+// ParsePage parses the content of a markdown page. Lines starting with "- " inside code fences are treated as
+// content of the surrounding block; all lines which do not start a block belong to the block before them.
+func ParsePage(content string) *Page {
+	page := &Page{}
+	if content == "" {
+		return page
+	}
+
+	if strings.HasSuffix(content, "\n") {
+		page.trailingNewline = true
+		content = strings.TrimSuffix(content, "\n")
+	}
+
+	var stack []*Block
+	var current *Block
+	var fence string
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence == "" {
+			if match := blockStart.FindStringSubmatch(line); match != nil {
+				current = &Block{Indent: match[1], lines: []string{line}}
+
+				for len(stack) > 0 && len(stack[len(stack)-1].Indent) >= len(current.Indent) {
+					stack = stack[:len(stack)-1]
+				}
+				if len(stack) == 0 {
+					page.Blocks = append(page.Blocks, current)
+				} else {
+					parent := stack[len(stack)-1]
+					parent.Children = append(parent.Children, current)
+				}
+				stack = append(stack, current)
+
+				fence = codeFence(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "-")), "")
+				continue
+			}
+		}
+
+		if current == nil {
+			page.Preamble = append(page.Preamble, line)
+		} else {
+			current.lines = append(current.lines, line)
+		}
+		fence = codeFence(trimmed, fence)
+	}
+
+	return page
+}
+
+// codeFence returns the fence which is open after a line with the given trimmed content, if `open` was open before.
+func codeFence(trimmed string, open string) string {
+	if open != "" {
+		if strings.HasPrefix(trimmed, open) {
+			return ""
+		}
+		return open
+	}
+
+	for _, f := range []string{"```", "~~~"} {
+		if strings.HasPrefix(trimmed, f) {
+			return f
+		}
+	}
+
+	return ""
+}
+
+// ParseBlock parses a single rendered block, e.g. the output of CreateTask. It returns nil if `content` has no block.
+func ParseBlock(content string) *Block {
+	page := ParsePage(content)
+	if len(page.Blocks) == 0 {
+		return nil
+	}
+
+	return page.Blocks[0]
+}
+
+// String serializes the page back into markdown.
+func (p *Page) String() string {
+	lines := append([]string{}, p.Preamble...)
+	for _, b := range p.Blocks {
+		lines = b.appendLines(lines)
+	}
+
+	content := strings.Join(lines, "\n")
+	if p.trailingNewline {
+		content += "\n"
+	}
+
+	return content
+}
+
+// Properties returns the page properties, which are either the property lines before the first block or the first
+// block if it only consists of properties.
+func (p *Page) Properties() map[string]string {
+	properties := make(map[string]string)
+
+	lines := p.Preamble
+	if len(lines) == 0 && len(p.Blocks) > 0 && p.Blocks[0].isPropertiesOnly() {
+		first := p.Blocks[0]
+		lines = append([]string{strings.TrimPrefix(strings.TrimLeft(first.lines[0], " \t"), "- ")}, first.lines[1:]...)
+	}
+
+	for _, line := range lines {
+		if key, value, ok := parseProperty(line); ok {
+			properties[strings.ToLower(key)] = value
+		}
+	}
+
+	return properties
+}
+
+// SetProperty sets the page property `key` to `value` in the preamble. Existing properties keep their position, new
+// ones are added after the last property at the start of the preamble.
+func (p *Page) SetProperty(key string, value string) {
+	end := 0
+	for i, line := range p.Preamble {
+		k, _, ok := parseProperty(line)
+		if !ok {
+			break
+		}
+		if strings.EqualFold(k, key) {
+			p.Preamble[i] = k + ":: " + value
+			return
+		}
+		end = i + 1
+	}
+
+	p.Preamble = append(p.Preamble[:end:end], append([]string{key + ":: " + value}, p.Preamble[end:]...)...)
+}
+
+// Append adds blocks as the last top-level blocks. An empty last block, as Logseq creates it for new journals,
+// is replaced by the first of them.
+func (p *Page) Append(blocks ...*Block) {
+	if n := len(p.Blocks); n > 0 && len(blocks) > 0 && p.Blocks[n-1].isEmpty() {
+		p.Blocks = p.Blocks[:n-1]
+	}
+
+	for _, b := range blocks {
+		b.SetIndent("")
+		p.Blocks = append(p.Blocks, b)
+	}
+}
+
+// Find returns the first block of the page, in document order, for which `match` returns true, or nil.
+func (p *Page) Find(match func(b *Block) bool) *Block {
+	return findBlock(p.Blocks, match)
+}
+
+// findBlock searches blocks and their children depth-first.
+func findBlock(blocks []*Block, match func(b *Block) bool) *Block {
+	for _, b := range blocks {
+		if match(b) {
+			return b
+		}
+		if found := findBlock(b.Children, match); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// Remove removes `block` from the page, wherever it is nested. It reports whether the block was found.
+func (p *Page) Remove(block *Block) bool {
+	return removeBlock(&p.Blocks, block)
+}
+
+// removeBlock removes block from blocks or their children.
+func removeBlock(blocks *[]*Block, block *Block) bool {
+	for i, b := range *blocks {
+		if b == block {
+			*blocks = append((*blocks)[:i:i], (*blocks)[i+1:]...)
+			return true
+		}
+		if removeBlock(&b.Children, block) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendLines appends the raw lines of the block and all its children to lines.
+func (b *Block) appendLines(lines []string) []string {
+	lines = append(lines, b.lines...)
+	for _, child := range b.Children {
+		lines = child.appendLines(lines)
+	}
+
+	return lines
+}
+
+// String serializes the block with all its children.
+func (b *Block) String() string {
+	return strings.Join(b.appendLines(nil), "\n")
+}
+
+// Content returns the text of the first line of the block, without indentation and "- ".
+func (b *Block) Content() string {
+	content := strings.TrimPrefix(strings.TrimSuffix(b.lines[0], "\r"), b.Indent+"-")
+
+	return strings.TrimPrefix(content, " ")
+}
+
+// SetContent replaces the text of the first line of the block.
+func (b *Block) SetContent(content string) {
+	b.lines[0] = b.Indent + "- " + content
+}
+
+// Marker returns the task marker the block starts with, e.g. "TODO", or an empty string.
+func (b *Block) Marker() string {
+	word, _, _ := strings.Cut(b.Content(), " ")
+	for _, marker := range Markers {
+		if word == marker {
+			return marker
+		}
+	}
+
+	return ""
+}
+
+// SetMarker replaces the task marker of the block, or puts `marker` in front of the content if it has none.
+func (b *Block) SetMarker(marker string) {
+	content := b.Content()
+	if old := b.Marker(); old != "" {
+		content = strings.TrimPrefix(strings.TrimPrefix(content, old), " ")
+	}
+
+	b.SetContent(strings.TrimSuffix(marker+" "+content, " "))
+}
+
+// Body returns the lines of the block after its properties, with the indentation of the block removed.
+func (b *Block) Body() []string {
+	var body []string
+	for _, line := range b.lines[1+len(b.propertyLines()):] {
+		body = append(body, strings.TrimPrefix(line, b.Indent+"  "))
+	}
+
+	return body
+}
+
+// propertyLines returns the property lines following the first line, including SCHEDULED and DEADLINE.
+func (b *Block) propertyLines() []string {
+	i := 1
+	for i < len(b.lines) && propertyLine.MatchString(b.lines[i]) {
+		i++
+	}
+
+	return b.lines[1:i]
+}
+
+// isEmpty reports whether the block has neither content nor children.
+func (b *Block) isEmpty() bool {
+	return len(b.lines) == 1 && strings.TrimSpace(b.Content()) == "" && len(b.Children) == 0
+}
+
+// isPropertiesOnly reports whether the first line and all other lines of the block are properties.
+func (b *Block) isPropertiesOnly() bool {
+	if _, _, ok := parseProperty(b.Content()); !ok {
+		return false
+	}
+
+	return len(b.propertyLines()) == len(b.lines)-1 && len(b.Children) == 0
+}
+
+// Property returns the value of the block property `key`, which is matched case-insensitively.
+// SCHEDULED and DEADLINE are available as properties as well.
+func (b *Block) Property(key string) (string, bool) {
+	for _, line := range b.propertyLines() {
+		if k, value, ok := parseProperty(line); ok && strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// Properties returns the keys of all block properties in their order.
+func (b *Block) Properties() []string {
+	var keys []string
+	for _, line := range b.propertyLines() {
+		if k, _, ok := parseProperty(line); ok {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// SetProperty sets the block property `key` to `value`. Existing properties keep their position,
+// new ones are added after the last property.
+func (b *Block) SetProperty(key string, value string) {
+	properties := b.propertyLines()
+	for i, l := range properties {
+		if k, _, ok := parseProperty(l); ok && strings.EqualFold(k, key) {
+			b.lines[i+1] = b.formatProperty(k, value)
+			return
+		}
+	}
+
+	end := 1 + len(properties)
+	b.lines = append(b.lines[:end:end], append([]string{b.formatProperty(key, value)}, b.lines[end:]...)...)
+}
+
+// formatProperty formats a property line of the block.
+func (b *Block) formatProperty(key string, value string) string {
+	if strings.EqualFold(key, "SCHEDULED") || strings.EqualFold(key, "DEADLINE") {
+		return b.Indent + "  " + strings.ToUpper(key) + ": " + value
+	}
+
+	return b.Indent + "  " + key + ":: " + value
+}
+
+// RemoveProperty removes the block property `key`. It reports whether the property existed.
+func (b *Block) RemoveProperty(key string) bool {
+	for i, l := range b.propertyLines() {
+		if k, _, ok := parseProperty(l); ok && strings.EqualFold(k, key) {
+			b.lines = append(b.lines[:i+1:i+1], b.lines[i+2:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetIndent moves the block with all its children to the given indentation.
+func (b *Block) SetIndent(indent string) {
+	old := b.Indent
+	for i, line := range b.lines {
+		if line != "" {
+			b.lines[i] = indent + strings.TrimPrefix(line, old)
+		}
+	}
+	b.Indent = indent
+
+	for _, child := range b.Children {
+		child.SetIndent(indent + child.Indent[min(len(old), len(child.Indent)):])
+	}
+}
+
+// AddChild appends `child` as the last child of the block, indented one level deeper.
+func (b *Block) AddChild(child *Block) {
+	child.SetIndent(b.childIndent())
+	b.Children = append(b.Children, child)
+}
+
+// childIndent returns the indentation of the children, using the style of existing children if there are any.
+func (b *Block) childIndent() string {
+	if len(b.Children) > 0 {
+		return b.Children[0].Indent
+	}
+
+	return b.Indent + "  "
+}
+
+// parseProperty splits a property line into key and value. SCHEDULED and DEADLINE lines are properties as well.
+func parseProperty(line string) (key string, value string, ok bool) {
+	match := propertyLine.FindStringSubmatch(line)
+	if match == nil {
+		return "", "", false
+	}
+
+	if match[3] != "" {
+		return match[3], match[4], true
+	}
+
+	return match[1], match[2], true
+}
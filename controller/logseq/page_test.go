@@ -0,0 +1,114 @@
+package logseq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"single newline", "\n"},
+		{"no trailing newline", "- a\n- b"},
+		{"trailing newline", "- a\n- b\n"},
+		{"several trailing newlines", "- a\n\n\n"},
+		{"preamble", "title:: Page\nalias:: p\n\n- a\n"},
+		{"crlf", "title:: Page\r\n- TODO a\r\n  id:: 1\r\n  - child\r\n"},
+		{"nested spaces", "- a\n  - b\n    - c\n  - d\n- e\n"},
+		{"nested tabs", "- a\n\t- b\n\t\t- c\n\t- d\n"},
+		{"mixed indentation", "- a\n\t- b\n    - c\n- d\n"},
+		{"multi-line block", "- a\n  second line\n\n  third line\n- b\n"},
+		{"code fence", "- code\n  ```\n  - not a block\n  ```\n- b\n"},
+		{"tilde fence", "- code\n  ~~~go\n- not a block\n  ~~~\n- b\n"},
+		{"fence on first line", "- ```\n  - not a block\n  ```\n"},
+		{"empty block", "- a\n-\n"},
+		{"trailing whitespace", "- a  \n  key::  value \t\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParsePage(tt.content).String(); got != tt.content {
+				t.Errorf("ParsePage(%q).String() = %q", tt.content, got)
+			}
+		})
+	}
+}
+
+func TestParsePageTree(t *testing.T) {
+	page := ParsePage("props:: x\n- a\n  - b\n    ```\n    - fenced\n    ```\n  - c\n- d\n")
+
+	if !reflect.DeepEqual(page.Preamble, []string{"props:: x"}) {
+		t.Errorf("Preamble = %q", page.Preamble)
+	}
+	if len(page.Blocks) != 2 {
+		t.Fatalf("got %d top-level blocks, want 2", len(page.Blocks))
+	}
+
+	a := page.Blocks[0]
+	if len(a.Children) != 2 || a.Children[0].Content() != "b" || a.Children[1].Content() != "c" {
+		t.Errorf("children of a = %v", a.Children)
+	}
+	if got := a.Children[0].Body(); !reflect.DeepEqual(got, []string{"```", "- fenced", "```"}) {
+		t.Errorf("Body() of b = %q", got)
+	}
+}
+
+func TestBlockProperties(t *testing.T) {
+	block := ParseBlock("- TODO task\n  a:: 1\n  SCHEDULED: <2024-01-02 Tue>\n  b::\n  text\n  c:: not a property")
+
+	if got := block.Properties(); !reflect.DeepEqual(got, []string{"a", "SCHEDULED", "b"}) {
+		t.Errorf("Properties() = %q", got)
+	}
+	if value, ok := block.Property("A"); !ok || value != "1" {
+		t.Errorf("Property(A) = %q, %v", value, ok)
+	}
+	if value, ok := block.Property("scheduled"); !ok || value != "<2024-01-02 Tue>" {
+		t.Errorf("Property(scheduled) = %q, %v", value, ok)
+	}
+
+	block.SetProperty("a", "2")
+	block.SetProperty("d", "4")
+	block.RemoveProperty("b")
+	block.SetMarker("DONE")
+
+	want := "- DONE task\n  a:: 2\n  SCHEDULED: <2024-01-02 Tue>\n  d:: 4\n  text\n  c:: not a property"
+	if got := block.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestPageSetProperty(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty page", "", "alias:: x"},
+		{"existing property", "Alias:: old\ntitle:: t\n- a\n", "Alias:: x\ntitle:: t\n- a\n"},
+		{"after properties", "title:: t\n\ntext\n- a\n", "title:: t\nalias:: x\n\ntext\n- a\n"},
+		{"no preamble", "- a\n", "alias:: x\n- a\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := ParsePage(tt.content)
+			page.SetProperty("alias", "x")
+			if got := page.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockSetIndent(t *testing.T) {
+	block := ParseBlock("- a\n  text\n\n  - b\n    - c")
+	block.SetIndent("\t")
+
+	want := "\t- a\n\t  text\n\n\t  - b\n\t    - c"
+	if got := block.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package logseq
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Actions for entries which disappeared from the source system, see StaleConfig.
+const (
+	StaleDelete      = "delete"
+	StaleDone        = "done"
+	StaleCanceled    = "canceled"
+	StaleArchive     = "archive"
+	StaleArchivePage = "archivePage"
+)
+
+// MissingSinceProperty records when a synced entry was missing in the source system for the first time.
+const MissingSinceProperty = "logseq-connector-missing-since"
+
+// PendingProperty marks a synced entry created from Logseq, which the source system has not returned yet, e.g. as its
+// search index lags behind. The entry is kept out of the stale handling until it is returned once.
+const PendingProperty = "logseq-connector-pending"
+
+// archiveProperty marks the Archive section of a page, which collects the archived entries as children.
+const archiveProperty = "logseq-connector-archive"
+
+// StaleConfig controls what happens to synced entries which are no longer returned by the source system.
+type StaleConfig struct {
+	// Action is one of StaleDelete (default), StaleDone, StaleCanceled, StaleArchive or StaleArchivePage.
+	Action string
+	// Grace is the duration an entry has to be missing before the action is applied, e.g. "24h". Until then the
+	// entry stays on the page unchanged.
+	Grace string
+}
+
+// Validate checks the action and the grace period.
+func (s StaleConfig) Validate() error {
+	switch s.action() {
+	case StaleDelete, StaleDone, StaleCanceled, StaleArchive, StaleArchivePage:
+	default:
+		return errors.New("stale action must be one of delete, done, canceled, archive, archivePage")
+	}
+
+	if s.Grace != "" {
+		if _, err := time.ParseDuration(s.Grace); err != nil {
+			return errors.New("invalid stale grace: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// ArchivePage reports whether archived entries are moved to their own page.
+func (s StaleConfig) ArchivePage() bool {
+	return s.action() == StaleArchivePage
+}
+
+// action returns the configured action, StaleDelete if none is set. Actions are matched case-insensitively.
+func (s StaleConfig) action() string {
+	for _, action := range []string{StaleDone, StaleCanceled, StaleArchive, StaleArchivePage} {
+		if strings.EqualFold(s.Action, action) {
+			return action
+		}
+	}
+	if s.Action == "" {
+		return StaleDelete
+	}
+
+	return strings.ToLower(s.Action)
+}
+
+// grace returns the grace period. Invalid values are rejected by Validate, so they count as no grace period.
+func (s StaleConfig) grace() time.Duration {
+	grace, _ := time.ParseDuration(s.Grace)
+	return grace
+}
+
+// isArchive reports whether the block is the Archive section of a page.
+func isArchive(b *Block) bool {
+	return hasProperty(b, archiveProperty)
+}
+
+// newArchive creates an empty, collapsed Archive section.
+func newArchive() *Block {
+	return ParseBlock("- Archive\n  " + archiveProperty + ":: true\n  collapsed:: true")
+}
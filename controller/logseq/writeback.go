@@ -0,0 +1,43 @@
+package logseq
+
+// MarkerProperty holds the marker a synced entry had in the source system at the last sync. A different marker on the
+// block means it was changed in Logseq since then.
+const MarkerProperty = "logseq-connector-marker"
+
+// Change is a marker of a synced entry changed in Logseq since the last sync.
+type Change struct {
+	// Id is the connector-scoped identity of the entry.
+	Id string
+	// Synced is the marker written by the last sync.
+	Synced string
+	// Marker is the current marker of the block.
+	Marker string
+}
+
+// Changes returns the top-level entries of the page whose marker differs from the one written by the last sync.
+// Entries which went missing in the source system are skipped, as their marker may have been set by the stale action.
+func Changes(page *Page) []Change {
+	var changes []Change
+	for _, b := range page.Blocks {
+		id := Identity(b)
+		synced := propertyValue(b, MarkerProperty)
+		if id == "" || synced == "" || hasProperty(b, MissingSinceProperty) {
+			continue
+		}
+
+		if marker := b.Marker(); marker != "" && marker != synced {
+			changes = append(changes, Change{Id: id, Synced: synced, Marker: marker})
+		}
+	}
+
+	return changes
+}
+
+// setSyncedMarker records the marker the entry was rendered with, or removes the record if it has none.
+func setSyncedMarker(block *Block) {
+	if marker := block.Marker(); marker != "" {
+		block.SetProperty(MarkerProperty, marker)
+	} else {
+		block.RemoveProperty(MarkerProperty)
+	}
+}
@@ -1,13 +1,18 @@
 package paperless
 
 import (
-	"Logseq_connector/controller/fileFunctions"
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/logseq"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/kennygrant/sanitize"
 	"io"
 	"log"
 	"net/http"
 	neturl "net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -108,18 +113,71 @@ type DocumentType struct {
 	UserCanChange     bool        `json:"user_can_change"`
 }
 
-var config Config
+// Connector synchronizes the documents of one Paperless-ngx installation into one page per correspondent.
+type Connector struct {
+	config Config
+	files  map[string]string
+	items  map[string]int
+}
+
+func init() {
+	connector.Register("paperless", connector.Instances(New))
+}
+
+// New creates a Paperless connector for the given instance configuration.
+func New(extConf Config) connector.Connector {
+	return &Connector{config: extConf}
+}
+
+// Name returns the configured instance name.
+func (c *Connector) Name() string {
+	return c.config.Name
+}
+
+// Graph returns the key of the graph the documents are written to.
+func (c *Connector) Graph() string {
+	return c.config.Graph
+}
+
+// Validate checks that all required settings of the instance are present.
+func (c *Connector) Validate() error {
+	switch {
+	case c.config.Name == "":
+		return errors.New("name is required")
+	case c.config.Username == "":
+		return errors.New("username is required")
+	case c.config.Password == "":
+		return errors.New("password is required")
+	case c.config.Url == "":
+		return errors.New("url is required")
+	}
 
-func Process(extConf Config, path string) {
-	config = extConf
+	return nil
+}
 
-	login(config.Username, config.Password, config.Url)
+// Fetch loads all documents with their tags, correspondents and document types and groups them by correspondent.
+func (c *Connector) Fetch(context.Context) error {
+	if err := c.login(c.config.Username, c.config.Password, c.config.Url); err != nil {
+		return err
+	}
 
 	result := make(map[string][]string)
-	documents := documentsGet("")
-	tags := tagsGet("")
-	correspondents := correspondentsGet("")
-	documentTypes := documentTypesGet("")
+	documents, err := c.documentsGet("")
+	if err != nil {
+		return err
+	}
+	tags, err := c.tagsGet("")
+	if err != nil {
+		return err
+	}
+	correspondents, err := c.correspondentsGet("")
+	if err != nil {
+		return err
+	}
+	documentTypes, err := c.documentTypesGet("")
+	if err != nil {
+		return err
+	}
 
 	for _, doc := range documents {
 		var docTags []string
@@ -132,23 +190,50 @@ func Process(extConf Config, path string) {
 
 		line := dateToLogseqDate(doc.CreatedDate) + " " +
 			getDocType(&documentTypes, doc.DocumentType) + " " +
-			getDocLink(doc.ID, doc.Title) + " " +
+			c.getDocLink(doc.ID, doc.Title) + " " +
 			strings.Join(docTags[:], " ")
 
-		result[correspondent] = append(result[correspondent], "- "+line)
+		block := logseq.ParseBlock("- " + line)
+		logseq.SetIdentity(block, "paperless/"+c.config.Name+"/"+strconv.Itoa(doc.ID))
+
+		result[correspondent] = append(result[correspondent], block.String())
 	}
 
-	for filename, fileContent := range getFiles(result) {
-		fileHandle, handleErr := fileFunctions.GetFilehandle(path + config.Name + "___" + filename + ".md")
-		if handleErr != nil {
-			log.Println(handleErr)
-		}
-		fileFunctions.WriteFile(fileContent, fileHandle)
+	c.files = getFiles(result)
+	c.items = make(map[string]int)
+	for correspondent, lines := range result {
+		c.items[sanitize.BaseName(correspondent)] += len(lines)
 	}
+
+	return nil
 }
 
-func login(username string, password string, url string) {
-	config.Url = url
+// Render returns one page per correspondent, each rebuilt from the fetched documents.
+func (c *Connector) Render() []connector.Page {
+	var pages []connector.Page
+
+	filenames := make([]string, 0, len(c.files))
+	for filename := range c.files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		fileContent := c.files[filename]
+		pages = append(pages, connector.Page{
+			File:  "pages/documents___paperless___" + c.config.Name + "___" + filename + ".md",
+			Items: c.items[filename],
+			Update: func(string) string {
+				return fileContent
+			},
+		})
+	}
+
+	return pages
+}
+
+func (c *Connector) login(username string, password string, url string) error {
+	c.config.Url = url
 
 	type Token struct {
 		Token string
@@ -158,9 +243,9 @@ func login(username string, password string, url string) {
 	params.Add("username", username)
 	params.Add("password", password)
 
-	resp, err := http.PostForm(config.Url+"api/token/", params)
+	resp, err := http.PostForm(c.config.Url+"api/token/", params)
 	if err != nil {
-		log.Printf("Request Failed: %s", err)
+		return fmt.Errorf("request failed: %w", err)
 	}
 	defer func(Body io.ReadCloser) {
 		err = Body.Close()
@@ -169,24 +254,36 @@ func login(username string, password string, url string) {
 		}
 	}(resp.Body)
 	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login failed: %s\n%s", resp.Status, string(body))
+	}
 
 	// Unmarshal result
 	tempToken := Token{}
 	err = json.Unmarshal(body, &tempToken)
 	if err != nil {
-		log.Printf("Reading body failed: %s", err)
+		return fmt.Errorf("reading body failed: %w", err)
 	}
 
-	config.Token = tempToken.Token
+	c.config.Token = tempToken.Token
+
+	return nil
 }
 
-func elementsGet(uri string) []byte {
-	uri = httpToHttps(uri)
+func (c *Connector) elementsGet(uri string) ([]byte, error) {
+	uri = c.httpToHttps(uri)
 	// Create a Bearer string by appending string access token
-	var bearer = "Token " + config.Token
+	var bearer = "Token " + c.config.Token
 
 	// Create a new request using http
 	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	// add authorization header to the req
 	req.Header.Add("Authorization", bearer)
@@ -195,7 +292,7 @@ func elementsGet(uri string) []byte {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		if err = Body.Close(); err != nil {
@@ -205,94 +302,134 @@ func elementsGet(uri string) []byte {
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Println(err.Error())
+		return nil, err
 	}
 
-	return body
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get %s: %s", uri, resp.Status)
+	}
+
+	return body, nil
 }
 
-func documentsGet(uri string) (documents []Document) {
+func (c *Connector) documentsGet(uri string) (documents []Document, err error) {
 	if len(uri) == 0 {
-		uri = config.Url + "api/documents/?ordering=created&page_size=250&truncate_content=true"
+		uri = c.config.Url + "api/documents/?ordering=created&page_size=250&truncate_content=true"
+	}
+
+	body, err := c.elementsGet(uri)
+	if err != nil {
+		return nil, err
 	}
 
 	var temp Documents
-	err := json.Unmarshal(elementsGet(uri), &temp)
+	err = json.Unmarshal(body, &temp)
 	if err != nil {
-		log.Printf("Reading body failed: %s", err)
+		return nil, fmt.Errorf("reading body failed: %w", err)
 	}
 
 	documents = append(documents, temp.Documents...)
 
 	if len(temp.Next) > 0 {
-		documents = append(documents, documentsGet(temp.Next)...)
+		next, err := c.documentsGet(temp.Next)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, next...)
 	}
 
-	return documents
+	return documents, nil
 }
 
-func tagsGet(uri string) (tags []Tag) {
+func (c *Connector) tagsGet(uri string) (tags []Tag, err error) {
 	if len(uri) == 0 {
-		uri = config.Url + "api/tags/?ordering=-added&page_size=250&truncate_content=true"
+		uri = c.config.Url + "api/tags/?ordering=-added&page_size=250&truncate_content=true"
+	}
+
+	body, err := c.elementsGet(uri)
+	if err != nil {
+		return nil, err
 	}
 
 	var temp Tags
-	err := json.Unmarshal(elementsGet(uri), &temp)
+	err = json.Unmarshal(body, &temp)
 	if err != nil {
-		log.Printf("Reading body failed: %s", err)
+		return nil, fmt.Errorf("reading body failed: %w", err)
 	}
 
 	tags = append(tags, temp.Tags...)
 
 	if len(temp.Next) > 0 {
-		tags = append(tags, tagsGet(temp.Next)...)
+		next, err := c.tagsGet(temp.Next)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, next...)
 	}
 
-	return tags
+	return tags, nil
 }
 
-func documentTypesGet(uri string) (documentTypes []DocumentType) {
+func (c *Connector) documentTypesGet(uri string) (documentTypes []DocumentType, err error) {
 	if len(uri) == 0 {
-		uri = config.Url + "api/document_types/?ordering=-added&page_size=250&truncate_content=true"
+		uri = c.config.Url + "api/document_types/?ordering=-added&page_size=250&truncate_content=true"
+	}
+
+	body, err := c.elementsGet(uri)
+	if err != nil {
+		return nil, err
 	}
 
 	var temp DocumentTypes
-	err := json.Unmarshal(elementsGet(uri), &temp)
+	err = json.Unmarshal(body, &temp)
 	if err != nil {
-		log.Printf("Reading body failed: %s", err)
+		return nil, fmt.Errorf("reading body failed: %w", err)
 	}
 
 	documentTypes = append(documentTypes, temp.DocumentTypes...)
 
 	if len(temp.Next) > 0 {
-		documentTypes = append(documentTypes, documentTypesGet(temp.Next)...)
+		next, err := c.documentTypesGet(temp.Next)
+		if err != nil {
+			return nil, err
+		}
+		documentTypes = append(documentTypes, next...)
 	}
 
-	return documentTypes
+	return documentTypes, nil
 }
 
-func correspondentsGet(uri string) (correspondents []Correspondent) {
+func (c *Connector) correspondentsGet(uri string) (correspondents []Correspondent, err error) {
 	if len(uri) == 0 {
-		uri = config.Url + "api/correspondents/?ordering=-added&page_size=250&truncate_content=true"
+		uri = c.config.Url + "api/correspondents/?ordering=-added&page_size=250&truncate_content=true"
+	}
+
+	body, err := c.elementsGet(uri)
+	if err != nil {
+		return nil, err
 	}
 
 	var temp Correspondents
-	err := json.Unmarshal(elementsGet(uri), &temp)
+	err = json.Unmarshal(body, &temp)
 	if err != nil {
-		log.Printf("Reading body failed: %s", err)
+		return nil, fmt.Errorf("reading body failed: %w", err)
 	}
 
 	correspondents = append(correspondents, temp.Correspondents...)
 
 	if len(temp.Next) > 0 {
-		correspondents = append(correspondents, correspondentsGet(temp.Next)...)
+		next, err := c.correspondentsGet(temp.Next)
+		if err != nil {
+			return nil, err
+		}
+		correspondents = append(correspondents, next...)
 	}
 
-	return correspondents
+	return correspondents, nil
 }
 
-func httpToHttps(uri string) string {
-	if strings.Contains(config.Url, "https://") {
+func (c *Connector) httpToHttps(uri string) string {
+	if strings.Contains(c.config.Url, "https://") {
 		return strings.ReplaceAll(uri, "http://", "https://")
 	}
 
@@ -309,8 +446,8 @@ func getTagName(tags *[]Tag, id int) string {
 	return ""
 }
 
-func getDocLink(id int, name string) string {
-	return "[Paperless](" + config.Url + "documents/" + strconv.Itoa(id) + "/) [[" + name + "]]"
+func (c *Connector) getDocLink(id int, name string) string {
+	return "[Paperless](" + c.config.Url + "documents/" + strconv.Itoa(id) + "/) [[" + name + "]]"
 }
 
 func getDocType(docTypes *[]DocumentType, id int) string {
@@ -347,7 +484,11 @@ func getFiles(docLines map[string][]string) map[string]string {
 
 	if len(docLines) > 0 {
 		for correspondent, lines := range docLines {
-			files[sanitize.BaseName(correspondent)] = strings.Join(append([]string{"- Alias:: " + correspondent}, lines...), "\n")
+			page := logseq.ParsePage("- Alias:: " + correspondent)
+			for _, line := range lines {
+				page.Append(logseq.ParsePage(line).Blocks...)
+			}
+			files[sanitize.BaseName(correspondent)] = page.String()
 		}
 	}
 
@@ -1,16 +1,18 @@
 package sapcloudalm
 
 import (
-	"Logseq_connector/controller/fileFunctions"
+	"Logseq_connector/controller/connector"
 	"Logseq_connector/controller/logseq"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
+	"strconv"
 	"strings"
 )
 
@@ -24,9 +26,27 @@ type Config struct {
 	Url          string
 	TokenUrl     string
 	Token        string
+	Stale        logseq.StaleConfig
+	// Mapping overrides or extends statusMarkers and priorityNumbers. Priorities are the numeric priority IDs.
+	logseq.Mapping
 }
 
-var config Config
+// Connector synchronizes the tasks of one SAP Cloud ALM instance the user is involved in.
+type Connector struct {
+	config  Config
+	entries []logseq.Entry
+	// partial is set if the tasks of a project could not be fetched, so the stale handling is skipped.
+	partial bool
+}
+
+func init() {
+	connector.Register("sapcloudalm", connector.Instances(New))
+}
+
+// New creates a SAP Cloud ALM connector for the given instance configuration.
+func New(extConf Config) connector.Connector {
+	return &Connector{config: extConf}
+}
 
 // TokenResponse represents the structure of an OAuth2 token response.
 // AccessToken is the issued token used for authentication.
@@ -60,7 +80,7 @@ func getAccessToken(clientID string, clientSecret string, tokenURL string) (stri
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			panic(err)
+			log.Println(err)
 		}
 	}(resp.Body)
 
@@ -78,12 +98,12 @@ func getAccessToken(clientID string, clientSecret string, tokenURL string) (stri
 }
 
 // getProjects retrieves a list of projects from the external API and returns it as a slice of map objects or an error.
-func getProjects() ([]map[string]interface{}, error) {
-	req, err := http.NewRequest("GET", config.Url+"api/calm-projects/v1/projects", nil)
+func (c *Connector) getProjects() ([]map[string]interface{}, error) {
+	req, err := http.NewRequest("GET", c.config.Url+"api/calm-projects/v1/projects", nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.Token)
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
 	req.Header.Set("Accept", "application/json")
 
 	client := &http.Client{}
@@ -94,7 +114,7 @@ func getProjects() ([]map[string]interface{}, error) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			panic(err)
+			log.Println(err)
 		}
 	}(resp.Body)
 
@@ -114,16 +134,16 @@ func getProjects() ([]map[string]interface{}, error) {
 
 // getTasksForProject retrieves tasks for a specific project by its ID using an API call and returns them as a slice of maps.
 // It returns an error if the request fails, the response status code is not OK, or the JSON decoding is unsuccessful.
-func getTasksForProject(projectID string) ([]map[string]interface{}, error) {
+func (c *Connector) getTasksForProject(projectID string) ([]map[string]interface{}, error) {
 	// Erstellen Sie die API-URL mit der projectId
-	apiURL := fmt.Sprintf("%sapi/calm-tasks/v1/tasks?projectId=%s", config.Url, projectID)
+	apiURL := fmt.Sprintf("%sapi/calm-tasks/v1/tasks?projectId=%s", c.config.Url, projectID)
 
 	// HTTP-Request erstellen
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.Token)
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
 	req.Header.Set("Accept", "application/json")
 
 	client := &http.Client{}
@@ -134,7 +154,7 @@ func getTasksForProject(projectID string) ([]map[string]interface{}, error) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			panic(err)
+			log.Println(err)
 		}
 	}(resp.Body)
 
@@ -155,15 +175,15 @@ func getTasksForProject(projectID string) ([]map[string]interface{}, error) {
 
 // createTaskEntry generates a formatted task entry string and a unique identifier based on the given task data.
 // It processes task information including status, priority, tags, due date, and project metadata.
-func createTaskEntry(task map[string]interface{}) (string, string) {
+func (c *Connector) createTaskEntry(task map[string]interface{}) (string, string) {
 	var lTask logseq.Task
 
-	lTask.ConfigName = config.Name
-	lTask.Status = getTaskType(task["status"].(string))
-	lTask.Priority = getTaskPriority(task["priorityId"].(float64))
+	lTask.ConfigName = c.config.Name
+	lTask.Status = c.config.Marker(task["status"].(string), statusMarkers)
+	lTask.Priority = c.config.Priority(strconv.FormatFloat(task["priorityId"].(float64), 'f', -1, 64), priorityNumbers)
 	lTask.Id = task["displayId"].(string)
 	lTask.Title = task["title"].(string)
-	lTask.Url = config.Url + "launchpad#task-management?route=taskDetail&/taskDetail/" + task["displayId"].(string)
+	lTask.Url = c.config.Url + "launchpad#task-management?route=taskDetail&/taskDetail/" + task["displayId"].(string)
 	lTask.Project = task["projectName"].(string)
 
 	if task["dueDate"] != nil && task["dueDate"].(string) != "" {
@@ -185,10 +205,10 @@ func createTaskEntry(task map[string]interface{}) (string, string) {
 	return logseq.CreateTask(lTask)
 }
 
-// isUserInvolved checks whether the user (from config.UserId) is involved in a task by assigneeId or involvedParties.
-func isUserInvolved(task map[string]interface{}) bool {
+// isUserInvolved checks whether the configured user is involved in a task by assigneeId or involvedParties.
+func (c *Connector) isUserInvolved(task map[string]interface{}) bool {
 	assigneeID, ok := task["assigneeId"].(string)
-	if ok && assigneeID == config.UserId {
+	if ok && assigneeID == c.config.UserId {
 		return true
 	}
 
@@ -199,7 +219,7 @@ func isUserInvolved(task map[string]interface{}) bool {
 
 	entries := strings.Split(involvedParties, ",")
 	for _, entry := range entries {
-		if strings.TrimSpace(entry) == config.UserId {
+		if strings.TrimSpace(entry) == c.config.UserId {
 			return true
 		}
 	}
@@ -207,106 +227,130 @@ func isUserInvolved(task map[string]interface{}) bool {
 	return false
 }
 
-// getTaskType maps a task status string to a task type string such as TODO, DOING, WAIT, DONE, CLOSED, or UNKNOWN.
-func getTaskType(status string) string {
-	statusToType := map[string]string{
-		"CIPTKOPEN":    "TODO",
-		"CIPUSOPEN":    "TODO",
-		"CIPREQUOPEN":  "TODO",
-		"CIPDFCTOPEN":  "TODO",
-		"CIPTKINP":     "DOING",
-		"CIPUSINP":     "DOING",
-		"CIPREQUINP":   "DOING",
-		"CIPDFCTINP":   "DOING",
-		"CIPTKBLK":     "WAIT",
-		"CIPUSBLK":     "WAIT",
-		"CIPREQUBLK":   "WAIT",
-		"CIPDFCTBLK":   "WAIT",
-		"CIPTKNO":      "CLOSED",
-		"CIPUSNO":      "CLOSED",
-		"CIPREQUNO":    "CLOSED",
-		"CIPTKCLOSE":   "DONE",
-		"CIPUSCLOSE":   "DONE",
-		"CIPREQUCLOSE": "DONE",
-		"CIPDFCTDONE":  "DONE",
-	}
+// statusMarkers are the built-in markers of the task statuses.
+var statusMarkers = map[string]string{
+	"CIPTKOPEN":    "TODO",
+	"CIPUSOPEN":    "TODO",
+	"CIPREQUOPEN":  "TODO",
+	"CIPDFCTOPEN":  "TODO",
+	"CIPTKINP":     "DOING",
+	"CIPUSINP":     "DOING",
+	"CIPREQUINP":   "DOING",
+	"CIPDFCTINP":   "DOING",
+	"CIPTKBLK":     "WAIT",
+	"CIPUSBLK":     "WAIT",
+	"CIPREQUBLK":   "WAIT",
+	"CIPDFCTBLK":   "WAIT",
+	"CIPTKNO":      "CANCELED",
+	"CIPUSNO":      "CANCELED",
+	"CIPREQUNO":    "CANCELED",
+	"CIPTKCLOSE":   "DONE",
+	"CIPUSCLOSE":   "DONE",
+	"CIPREQUCLOSE": "DONE",
+	"CIPDFCTDONE":  "DONE",
+}
 
-	if taskType, ok := statusToType[status]; ok {
-		return taskType
-	}
-	return "UNKNOWN"
+// priorityNumbers are the built-in priority numbers of the numeric priority IDs, see logseq.GetPrio.
+var priorityNumbers = map[string]int{
+	"10": 1,
+	"20": 2,
+	"30": 3,
+	"40": 4,
 }
 
-// getTaskPriority returns a string representation of a task priority based on the provided numeric priority ID.
-func getTaskPriority(priorityId float64) int {
-	switch priorityId {
-	case 10:
-		return 1
-	case 20:
-		return 2
-	case 30:
-		return 3
-	case 40:
-		return 4
-	}
+// Name returns the configured instance name.
+func (c *Connector) Name() string {
+	return c.config.Name
+}
 
-	return 0
+// Graph returns the key of the graph the tasks are written to.
+func (c *Connector) Graph() string {
+	return c.config.Graph
 }
 
-// Process retrieves tasks from multiple projects, applies user-specific filters, and returns a list of relevant tasks.
-func Process(extConf Config, path string) {
-	config = extConf
+// Validate checks that all required settings of the instance are present.
+func (c *Connector) Validate() error {
+	switch {
+	case c.config.Name == "":
+		return errors.New("name is required")
+	case c.config.ClientId == "":
+		return errors.New("clientId is required")
+	case c.config.ClientSecret == "":
+		return errors.New("clientSecret is required")
+	case c.config.UserId == "":
+		return errors.New("userId is required")
+	case c.config.Url == "":
+		return errors.New("url is required")
+	case c.config.TokenUrl == "":
+		return errors.New("tokenUrl is required")
+	}
+
+	if err := c.config.Mapping.Validate(); err != nil {
+		return err
+	}
+
+	return c.config.Stale.Validate()
+}
 
+// Fetch retrieves tasks from multiple projects, applies user-specific filters, and formats the relevant tasks.
+// Projects whose tasks cannot be fetched are logged and skipped, and the page is rendered as partial.
+func (c *Connector) Fetch(context.Context) error {
 	var err error
-	config.Token, err = getAccessToken(config.ClientId, config.ClientSecret, config.TokenUrl)
+	c.config.Token, err = getAccessToken(c.config.ClientId, c.config.ClientSecret, c.config.TokenUrl)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	projects, err := getProjects()
+	projects, err := c.getProjects()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	var allUserTasks []map[string]interface{}
-	var fileContent string
+	var entries []logseq.Entry
+	c.partial = false
 
 	for _, project := range projects {
 		projectID, ok := project["id"].(string)
 		if !ok {
-			fmt.Printf("Invalid project ID format: %v\n", project["id"])
+			log.Printf("%s: invalid project ID format: %v", c.config.Name, project["id"])
+			c.partial = true
 			continue
 		}
 		projectName, _ := project["name"].(string)
 
-		tasks, err := getTasksForProject(projectID)
+		tasks, err := c.getTasksForProject(projectID)
 		if err != nil {
-			fmt.Printf("Failed to get tasks for project %s: %v\n", projectID, err)
+			log.Printf("%s: failed to get tasks for project %s, skipping the stale handling: %v", c.config.Name, projectID, err)
+			c.partial = true
 			continue
 		}
 
 		for _, task := range tasks {
-			if isUserInvolved(task) {
+			if c.isUserInvolved(task) {
 				task["projectName"] = projectName
-				allUserTasks = append(allUserTasks, task)
-				taskLine, uniqueStr := createTaskEntry(task)
-				fileContent = logseq.AddOrReplaceEntry(uniqueStr, taskLine, fileContent)
+				taskLine, uniqueStr := c.createTaskEntry(task)
+				entries = append(entries, logseq.Entry{Content: taskLine, Id: "sapcloudalm/" + c.config.Name + "/" + task["displayId"].(string), UniqueStr: uniqueStr})
 			}
 		}
 	}
 
-	filename := path + config.Name + ".md"
+	c.entries = entries
 
-	fileHandle, handleErr := fileFunctions.GetFilehandle(filename)
-	if handleErr != nil {
-		log.Println(err)
+	return nil
+}
+
+// Render returns the SAP Cloud ALM page of the instance, which is rebuilt from the fetched tasks.
+// Child blocks and properties the user added to a task are kept.
+// Entries which are no longer returned are handled according to the stale setting of the instance, unless the tasks
+// of a project could not be fetched.
+func (c *Connector) Render() []connector.Page {
+	file := "pages/sap___cloudalm___" + c.config.Name
+	page := &logseq.TaskPage{Entries: c.entries, Owned: logseq.TaskProperties, Stale: c.config.Stale, Partial: c.partial}
+
+	pages := []connector.Page{{File: file + ".md", Items: len(c.entries), Update: page.Update}}
+	if c.config.Stale.ArchivePage() {
+		pages = append(pages, connector.Page{File: file + "___archive.md", Update: page.UpdateArchive})
 	}
-	defer func(fileHandle *os.File) {
-		err := fileHandle.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(fileHandle)
 
-	fileFunctions.WriteFile(fileContent, fileHandle)
+	return pages
 }
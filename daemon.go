@@ -0,0 +1,64 @@
+package main
+
+import (
+	"Logseq_connector/controller/connector"
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// daemon re-syncs every instance on its own interval until ctx is cancelled. Instances without an interval use
+// defaultInterval. Runs of the same instance never overlap, and a sync in progress is finished before daemon returns.
+func (r *runner) daemon(ctx context.Context, instances []connector.Instance, defaultInterval time.Duration) {
+	var wg sync.WaitGroup
+
+	for _, instance := range instances {
+		interval := instance.Interval
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			timer := time.NewTimer(jitter(interval))
+			defer timer.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+
+				logResult(r.runOnce(context.WithoutCancel(ctx), instance, r.newBackup()))
+				r.pruneBackups()
+				timer.Reset(interval + jitter(interval))
+			}
+		}()
+	}
+
+	log.Println("daemon started with", len(instances), "instances")
+	<-ctx.Done()
+	log.Println("shutting down, waiting for running syncs")
+
+	wg.Wait()
+}
+
+// jitter returns a random delay of up to a tenth of interval, so instances with the same interval do not run in lockstep.
+func jitter(interval time.Duration) time.Duration {
+	return rand.N(interval/10 + 1)
+}
+
+// logResult logs the outcome of a successful run in daemon mode, errors are already logged by runOnce.
+func logResult(res result) {
+	if res.err != nil {
+		return
+	}
+
+	log.Printf("%s: %d items in %s", res.name, res.items, res.duration.Round(time.Millisecond))
+}
@@ -8,6 +8,7 @@ require (
 	github.com/kennygrant/sanitize v1.2.4
 	github.com/shomali11/util v0.0.0-20220717175126-f0771b70947f
 	github.com/xanzy/go-gitlab v0.115.0
+	golang.org/x/net v0.8.0
 	golang.org/x/text v0.24.0
 )
 
@@ -19,7 +20,6 @@ require (
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-retryablehttp v0.7.7 // indirect
 	github.com/trivago/tgo v1.0.7 // indirect
-	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/oauth2 v0.29.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 )
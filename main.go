@@ -1,71 +1,361 @@
 package main
 
 import (
-	"Logseq_connector/controller/calendar"
-	"Logseq_connector/controller/gitlab"
-	"Logseq_connector/controller/jira"
-	"Logseq_connector/controller/paperless"
-	"Logseq_connector/controller/sapcloudalm"
+	"Logseq_connector/controller/connector"
+	"Logseq_connector/controller/fileFunctions"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/shomali11/util/xconditions"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 )
 
+// defaultConcurrency is the number of connector instances running at the same time if not configured otherwise.
+const defaultConcurrency = 4
+
+// defaultInterval is the time between two runs of an instance in daemon mode if not configured otherwise.
+const defaultInterval = 15 * time.Minute
+
+// defaultBackupKeep is the number of backed up runs kept if not configured otherwise.
+const defaultBackupKeep = 10
+
 type Config struct {
 	Graph       map[string]string
-	Calendar    []calendar.Config
-	Gitlab      []gitlab.Config
-	Paperless   []paperless.Config
-	SapCloudAlm []sapcloudalm.Config
-	Jira        []jira.Config
+	Concurrency int
+	Interval    string
+	Backup      BackupConfig
+	Connectors  map[string]json.RawMessage `json:"-"`
+}
+
+// BackupConfig controls whether the previous content of changed files is kept, so a run can be rolled back.
+type BackupConfig struct {
+	Enabled bool
+	Folder  string
+	Keep    int
 }
 
 var config *Config
 
 func main() {
+	daemonMode := flag.Bool("daemon", false, "keep running and re-sync every instance on its own interval")
+	dryRun := flag.Bool("dry-run", false, "print a unified diff of every page change instead of writing it")
+	flag.Parse()
+
+	args := flag.Args()
+	rollback := len(args) > 0 && args[0] == "rollback"
+	if rollback {
+		args = args[1:]
+	}
+
 	var path string
 
-	if len(os.Args) > 1 {
-		path = os.Args[1] + xconditions.IfThenElse(string(os.Args[1][len(os.Args[1])-1:]) == "/", "", "/").(string)
+	if len(args) > 0 {
+		path = args[0] + xconditions.IfThenElse(string(args[0][len(args[0])-1:]) == "/", "", "/").(string)
 	}
 
 	getConfig(path + "config.json")
 
-	// region Calendar
-	for _, instance := range config.Calendar {
-		log.Println("get Calendar:", instance.Name)
-		calendar.GetCalendar(instance, path+config.Graph[instance.Graph])
+	backupRoot := config.Backup.Folder
+	if backupRoot == "" {
+		backupRoot = "backup"
+	}
+	if !filepath.IsAbs(backupRoot) {
+		backupRoot = path + backupRoot
+	}
+
+	if rollback {
+		restored, err := fileFunctions.Rollback(backupRoot)
+		for _, filename := range restored {
+			log.Println("restored", filename)
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	instances, err := connector.Load(config.Connectors)
+	if err != nil {
+		panic(err)
+	}
+
+	r := newRunner(path, config.Concurrency)
+	if *dryRun {
+		r.diffOut = os.Stdout
+	} else if config.Backup.Enabled {
+		r.backupRoot = backupRoot
+		r.backupKeep = config.Backup.Keep
+		if r.backupKeep < 1 {
+			r.backupKeep = defaultBackupKeep
+		}
+	}
+
+	if *daemonMode {
+		interval := defaultInterval
+		if config.Interval != "" {
+			interval, err = time.ParseDuration(config.Interval)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		r.daemon(ctx, instances, interval)
+		return
+	}
+
+	results := r.runAll(context.Background(), instances)
+
+	printSummary(os.Stdout, results)
+
+	for _, res := range results {
+		if res.err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// result is the outcome of a single connector instance run.
+type result struct {
+	name     string
+	items    int
+	duration time.Duration
+	err      error
+}
+
+// runner runs connector instances with bounded parallelism and serializes their writes per graph.
+type runner struct {
+	path  string
+	locks graphLocks
+	slots chan struct{}
+
+	// diffOut receives the diffs of all page changes in dry-run mode. Pages are only written if it is nil.
+	diffOut io.Writer
+	diffMu  sync.Mutex
+
+	// backupRoot is the folder the previous content of changed files is saved to. Backups are disabled if it is empty.
+	backupRoot string
+	backupKeep int
+	// backupMu is held for reading by every run, so old backups are only pruned while no run is saving files.
+	backupMu sync.RWMutex
+}
+
+// newRunner creates a runner for the graphs below path which runs at most concurrency instances at the same time.
+func newRunner(path string, concurrency int) *runner {
+	if concurrency < 1 {
+		concurrency = defaultConcurrency
+	}
+
+	return &runner{path: path, slots: make(chan struct{}, concurrency)}
+}
+
+// runAll runs all connector instances in parallel. A failing instance does not stop the others,
+// the results are returned in the order of the instances.
+func (r *runner) runAll(ctx context.Context, instances []connector.Instance) []result {
+	var wg sync.WaitGroup
+
+	results := make([]result, len(instances))
+	backup := r.newBackup()
+
+	for i, instance := range instances {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			results[i] = r.runOnce(ctx, instance, backup)
+		}()
+	}
+
+	wg.Wait()
+	r.pruneBackups()
+
+	return results
+}
+
+// runOnce runs a single instance as soon as a slot is free and reports the outcome.
+// The previous content of all changed files is saved to backup, unless it is nil.
+func (r *runner) runOnce(ctx context.Context, instance connector.Connector, backup *fileFunctions.Backup) result {
+	r.slots <- struct{}{}
+	defer func() { <-r.slots }()
+
+	r.backupMu.RLock()
+	defer r.backupMu.RUnlock()
+
+	log.Println("get", instance.Name())
+	start := time.Now()
+	items, err := r.run(ctx, instance, backup)
+	if err != nil {
+		log.Println(instance.Name()+":", err)
+	}
+
+	return result{name: instance.Name(), items: items, duration: time.Since(start), err: err}
+}
+
+// newBackup starts the backup of a new run, or returns nil if backups are disabled.
+func (r *runner) newBackup() *fileFunctions.Backup {
+	if r.backupRoot == "" {
+		return nil
+	}
+
+	return fileFunctions.NewBackup(r.backupRoot)
+}
+
+// pruneBackups removes the oldest backups beyond the configured number. It is skipped while runs are in progress.
+func (r *runner) pruneBackups() {
+	if r.backupRoot == "" || !r.backupMu.TryLock() {
+		return
+	}
+	defer r.backupMu.Unlock()
+
+	if err := fileFunctions.PruneBackups(r.backupRoot, r.backupKeep); err != nil {
+		log.Println(err)
+	}
+}
+
+// run validates and fetches a single connector instance and writes the rendered pages into its graph.
+// Connectors reading the graph read it first, connectors supporting write-back push the changes made in it.
+// It returns the number of rendered items. A panic inside the connector is turned into an error,
+// so it cannot abort the other instances.
+func (r *runner) run(ctx context.Context, instance connector.Connector, backup *fileFunctions.Backup) (items int, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	graph, ok := config.Graph[instance.Graph()]
+	if !ok {
+		return 0, errors.New("unknown graph " + instance.Graph())
 	}
-	// endregion
 
-	// region gitlab
-	for _, instance := range config.Gitlab {
-		log.Println("get Gitlab:", instance.Name)
-		gitlab.Process(instance, path+config.Graph[instance.Graph]+"/pages/gitlab___")
+	if err := instance.Validate(); err != nil {
+		return 0, err
 	}
-	// endregion
 
-	// region Paperless
-	for _, instance := range config.Paperless {
-		log.Println("get Paperless:", instance.Name)
-		paperless.Process(instance, path+config.Graph[instance.Graph]+"/pages/documents___paperless___")
+	graphPath := filepath.Clean(r.path + graph)
+
+	if reader, ok := instance.(connector.Reader); ok {
+		if err := reader.Read(os.DirFS(graphPath)); err != nil {
+			return 0, err
+		}
 	}
-	// endregion
 
-	// region SapCloudAlm
-	for _, instance := range config.SapCloudAlm {
-		log.Println("get SAP Cloud ALM:", instance.Name)
-		sapcloudalm.Process(instance, path+config.Graph[instance.Graph]+"/pages/sap___cloudalm___")
+	// a dry run must not change the source systems either
+	if pusher, ok := instance.(connector.Pusher); ok && r.diffOut == nil {
+		// pages returned along with an error record what was pushed before it failed
+		pages, pushErr := pusher.Push(ctx, os.DirFS(graphPath))
+		if _, err := r.write(graphPath, pages, backup); err != nil {
+			return 0, err
+		}
+		if pushErr != nil {
+			return 0, pushErr
+		}
 	}
-	// endregion
 
-	// region Jira
-	for _, instance := range config.Jira {
-		log.Println("get Jira:", instance.Name)
-		jira.Process(instance, path+config.Graph[instance.Graph]+"/pages/jira___")
+	if err := instance.Fetch(ctx); err != nil {
+		return 0, err
 	}
-	// endregion
+
+	return r.write(graphPath, instance.Render(), backup)
+}
+
+// write applies the pages to the graph, or prints their diff in a dry run. It returns the number of rendered items.
+func (r *runner) write(graphPath string, pages []connector.Page, backup *fileFunctions.Backup) (items int, err error) {
+	unlock := r.locks.lock(graphPath)
+	defer unlock()
+
+	for _, page := range pages {
+		filename := filepath.Join(graphPath, page.File)
+
+		if r.diffOut != nil {
+			err = r.printDiff(filename, page.Update)
+		} else {
+			err = fileFunctions.UpdateFile(filename, page.Update, backup)
+		}
+		if err != nil {
+			return items, err
+		}
+		items += page.Items
+	}
+
+	return items, nil
+}
+
+// printDiff prints the change update would make to filename without writing it.
+func (r *runner) printDiff(filename string, update func(string) string) error {
+	oldContent, err := fileFunctions.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	diff := fileFunctions.UnifiedDiff(filename, oldContent, update(oldContent))
+	if diff == "" {
+		return nil
+	}
+
+	r.diffMu.Lock()
+	defer r.diffMu.Unlock()
+
+	_, err = io.WriteString(r.diffOut, diff)
+
+	return err
+}
+
+// printSummary writes a table with the outcome of every instance run.
+func printSummary(out io.Writer, results []result) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "INSTANCE\tSTATUS\tITEMS\tDURATION\tERROR")
+	for _, r := range results {
+		status, errText := "ok", ""
+		if r.err != nil {
+			status, errText = "failed", strings.ReplaceAll(r.err.Error(), "\n", " ")
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", r.name, status, r.items, r.duration.Round(time.Millisecond), errText)
+	}
+
+	if err := w.Flush(); err != nil {
+		log.Println(err)
+	}
+}
+
+// graphLocks serializes the writes into a graph, so two connectors never change the same file at the same time.
+type graphLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock blocks until the given graph folder is free and returns the function to release it again.
+func (g *graphLocks) lock(graphPath string) func() {
+	g.mu.Lock()
+	if g.locks == nil {
+		g.locks = make(map[string]*sync.Mutex)
+	}
+	l, ok := g.locks[graphPath]
+	if !ok {
+		l = &sync.Mutex{}
+		g.locks[graphPath] = l
+	}
+	g.mu.Unlock()
+
+	l.Lock()
+
+	return l.Unlock
 }
 
 func getConfig(filename string) {
@@ -78,4 +368,9 @@ func getConfig(filename string) {
 	if err != nil {
 		panic(err)
 	} //nolint:errcheck
+
+	err = json.Unmarshal(f, &config.Connectors)
+	if err != nil {
+		panic(err)
+	}
 }